@@ -0,0 +1,224 @@
+package ansible
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"regexp"
+	"sort"
+	"time"
+)
+
+func ansibleHostsDataSource() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: ansibleHostsDataSourceRead,
+		Timeouts: &schema.ResourceTimeout{
+			Read: schema.DefaultTimeout(10 * time.Second),
+		},
+		Schema: map[string]*schema.Schema{
+			"inventory": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "ID of the inventory. Defaults to the inventory found at the provider path",
+			},
+			"inventory_name": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				Description:  "Name of the inventory, used to find it when no ID is given",
+				ValidateFunc: validateInventoryName,
+			},
+			"group": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include hosts of the group with this name, including hosts of its child groups",
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include hosts with a name matching this regular expression",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"variables": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "Only include hosts with all of these variables set to the given values. Values which are not strings are matched by their JSON encoding",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"ids": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "IDs of the matching hosts, ordered by name",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"names": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "Names of the matching hosts, ordered by name",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"hosts": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The matching hosts, ordered by name",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"groups": {
+							Type:        schema.TypeList,
+							Computed:    true,
+							Description: "Names of the groups the host is a member of",
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"variables_json": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Host variables as a JSON object, with the values of sensitive variables redacted",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func ansibleHostsDataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	conf := meta.(providerConfiguration)
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i, db, err := loadInventoryDatabase(conf, util.ResourceToString(d, "inventory"), util.ResourceToString(d, "inventory_name"), d.Timeout(schema.TimeoutRead))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var nameRegex *regexp.Regexp
+	if v := util.ResourceToString(d, "name_regex"); len(v) > 0 {
+		nameRegex = regexp.MustCompile(v)
+	}
+	hosts, err := findHosts(db, util.ResourceToString(d, "group"), nameRegex, util.ResourceToInterfaceMap(d, "variables"))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	ids := make([]string, 0, len(hosts))
+	names := make([]string, 0, len(hosts))
+	result := make([]interface{}, 0, len(hosts))
+	for _, h := range hosts {
+		vars, err := variablesToJSON(util.RedactVariables(h.GetVariables(), h.GetSensitiveNames()))
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		var groups []string
+		for _, g := range db.FindGroupsByEntryID(h.GetID()) {
+			groups = append(groups, g.GetName())
+		}
+		sort.Strings(groups)
+
+		ids = append(ids, h.GetID())
+		names = append(names, h.GetName())
+		result = append(result, map[string]interface{}{
+			"id":             h.GetID(),
+			"name":           h.GetName(),
+			"groups":         groups,
+			"variables_json": vars,
+		})
+	}
+
+	d.SetId(i.GetID())
+	_ = d.Set("inventory_name", inventoryName(conf, i))
+	_ = d.Set("ids", ids)
+	_ = d.Set("names", names)
+	if err := d.Set("hosts", result); err != nil {
+		return diag.Errorf("failed to set hosts: %s", err.Error())
+	}
+
+	return diags
+}
+
+// findHosts returns the hosts of the database matching all the given filters, ordered by name. An empty group, nil
+// nameRegex or empty variables matches every host.
+func findHosts(db *database.Database, group string, nameRegex *regexp.Regexp, variables map[string]interface{}) ([]*database.Host, error) {
+	var groups []database.Group
+	if len(group) > 0 {
+		g, err := db.FindGroupByName(group)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+		// hosts of child groups are also members of the group in Ansible, where a group shared by several children
+		// is only visited once
+		visited := map[string]bool{g.GetID(): true}
+		for n := 0; n < len(groups); n++ {
+			for _, id := range groups[n].GetChildren() {
+				if c := db.Group(id); c != nil && !visited[id] {
+					visited[id] = true
+					groups = append(groups, *c)
+				}
+			}
+		}
+	} else {
+		groups = db.SortedGroups()
+	}
+
+	seen := make(map[string]bool)
+	var hosts []*database.Host
+	for _, g := range groups {
+		for _, h := range g.GetHosts() {
+			if seen[h.GetID()] {
+				continue
+			}
+			seen[h.GetID()] = true
+			if nameRegex != nil && !nameRegex.MatchString(h.GetName()) {
+				continue
+			}
+			if !hostVariablesMatch(h, variables) {
+				continue
+			}
+			hosts = append(hosts, h)
+		}
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].GetName() != hosts[j].GetName() {
+			return hosts[i].GetName() < hosts[j].GetName()
+		}
+		return hosts[i].GetID() < hosts[j].GetID()
+	})
+	return hosts, nil
+}
+
+// hostVariablesMatch checks if the host has all the given variables. Values which are not strings are compared by
+// their JSON encoding, so a port of 22 matches "22".
+func hostVariablesMatch(h *database.Host, variables map[string]interface{}) bool {
+	for k, want := range variables {
+		v, err := h.GetVariable(k)
+		if err != nil {
+			return false
+		}
+		if s, ok := v.(string); ok {
+			if s != want {
+				return false
+			}
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil || string(data) != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package ansible
+
+import (
+	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestAnsibleHostsDataSource_Basic(t *testing.T) {
+	resourceName := "data.ansible_hosts.masters"
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAnsiblePreCheck(t, resourceName) },
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAnsibleHostsDataSourceBasic(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "names.#", "1"),
+					resource.TestCheckResourceAttr(resourceName, "names.0", "k3s-master-1"),
+					resource.TestCheckResourceAttrPair(resourceName, "ids.0", "ansible_host.k3s-master-1", "id"),
+					resource.TestCheckResourceAttr(resourceName, "hosts.0.groups.0", "master"),
+				),
+			},
+		},
+	})
+}
+
+func testHostsDatabase() (*database.Database, *database.Group) {
+	db := database.NewDatabase(DataSourcePath)
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("k3s-master-1", map[string]interface{}{"role": "master", "ansible_port": float64(22)}))
+	_ = db.AddGroup(*master)
+	node := database.NewGroup("node")
+	_ = node.AddEntity(database.NewHost("k3s-node-1", map[string]interface{}{"role": "node", "ansible_port": float64(22)}))
+	_ = node.AddEntity(database.NewHost("k3s-node-2", map[string]interface{}{"role": "node", "ansible_port": float64(2222)}))
+	_ = db.AddGroup(*node)
+	cluster := database.NewGroup("cluster")
+	_ = db.AddGroup(*cluster)
+	_ = db.SetChildren(cluster.GetID(), []string{master.GetID(), node.GetID()})
+	return db, master
+}
+
+func TestFindHosts(t *testing.T) {
+	db, _ := testHostsDatabase()
+	names := func(hosts []*database.Host) []string {
+		var n []string
+		for _, h := range hosts {
+			n = append(n, h.GetName())
+		}
+		return n
+	}
+
+	hosts, err := findHosts(db, "", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k3s-master-1", "k3s-node-1", "k3s-node-2"}, names(hosts))
+
+	hosts, err = findHosts(db, "cluster", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(hosts))
+
+	hosts, err = findHosts(db, "node", regexp.MustCompile("-2$"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k3s-node-2"}, names(hosts))
+
+	hosts, err = findHosts(db, "", nil, map[string]interface{}{"role": "node", "ansible_port": "22"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k3s-node-1"}, names(hosts))
+
+	hosts, err = findHosts(db, "", nil, map[string]interface{}{"missing": "x"})
+	assert.NoError(t, err)
+	assert.Empty(t, hosts)
+
+	_, err = findHosts(db, "unknown", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestAnsibleHostsDataSourceRead(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(DataSourcePath, os.ModePerm))
+	defer os.RemoveAll(DataSourcePath)
+
+	i := inventory.NewInventory(DataSourcePath)
+	assert.NoError(t, i.Commit(TestGroupVarsData))
+	db, master := testHostsDatabase()
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: DataSourcePath, Mutex: &sync.Mutex{}}
+	d := ansibleHostsDataSource().TestResourceData()
+	_ = d.Set("variables", map[string]interface{}{"role": "master"})
+	assert.False(t, ansibleHostsDataSourceRead(context.Background(), d, conf).HasError())
+
+	h, _ := master.FindEntityByName("k3s-master-1")
+	assert.Equal(t, []interface{}{h.GetID()}, d.Get("ids"))
+	assert.Equal(t, []interface{}{"k3s-master-1"}, d.Get("names"))
+	assert.Equal(t, []interface{}{"master"}, d.Get("hosts.0.groups"))
+	assert.Equal(t, `{"ansible_port":22,"role":"master"}`, d.Get("hosts.0.variables_json"))
+}
+
+func testAnsibleHostsDataSourceBasic() string {
+	return `
+provider "ansible" {
+  path = "/tmp/inventory"
+}
+
+resource "ansible_inventory" "cluster" {
+  group_vars = <<-EOT
+    ---
+    ansible_user: ubuntu
+  EOT
+}
+
+resource "ansible_group" "master" {
+  name = "master"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_host" "k3s-master-1" {
+  name = "k3s-master-1"
+  inventory = ansible_inventory.cluster.id
+  groups = [ansible_group.master.id]
+  variables = {
+    role = "master"
+  }
+}
+
+resource "ansible_host" "k3s-node-1" {
+  name = "k3s-node-1"
+  inventory = ansible_inventory.cluster.id
+  groups = [ansible_group.master.id]
+  variables = {
+    role = "node"
+  }
+}
+
+data "ansible_hosts" "masters" {
+  inventory = ansible_inventory.cluster.id
+  variables = {
+    role = "master"
+  }
+  depends_on = [ansible_host.k3s-master-1, ansible_host.k3s-node-1]
+}
+`
+}
@@ -0,0 +1,194 @@
+package ansible
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"time"
+)
+
+func ansibleInventoryDataSource() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: ansibleInventoryDataSourceRead,
+		Timeouts: &schema.ResourceTimeout{
+			Read: schema.DefaultTimeout(10 * time.Second),
+		},
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "ID of the inventory. Defaults to the inventory found at the provider path",
+			},
+			"name": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				Description:  "Name of the inventory, used to find it when no ID is given",
+				ValidateFunc: validateInventoryName,
+			},
+			"group_vars": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Ansible inventory group vars",
+			},
+			"group_vars_files": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Additional group vars files by their path relative to group_vars, such as all/main.yml",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"rendered_ini": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The inventory rendered as hosts.ini, with host variables inline except vault encrypted variables",
+			},
+			"rendered_yaml": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The inventory rendered as hosts.yml, with host variables inline",
+			},
+			"rendered_json": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The inventory rendered as dynamic inventory JSON",
+			},
+			"groups": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "Groups of the inventory, ordered by name",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"children": {
+							Type:        schema.TypeList,
+							Computed:    true,
+							Description: "IDs of the child groups",
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"variables_json": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Group variables as a JSON object",
+						},
+						"hosts": {
+							Type:        schema.TypeList,
+							Computed:    true,
+							Description: "Hosts of the group, ordered by name",
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"id": {
+										Type:     schema.TypeString,
+										Computed: true,
+									},
+									"name": {
+										Type:     schema.TypeString,
+										Computed: true,
+									},
+									"variables_json": {
+										Type:        schema.TypeString,
+										Computed:    true,
+										Description: "Host variables as a JSON object, with the values of sensitive variables redacted",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func ansibleInventoryDataSourceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	conf := meta.(providerConfiguration)
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	i, db, err := loadInventoryDatabase(conf, d.Get("id").(string), d.Get("name").(string), d.Timeout(schema.TimeoutRead))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	files, err := i.LoadGroupVarsFiles()
+	if err != nil {
+		return diag.Errorf("failed to load inventory '%s': %s", i.GetID(), err.Error())
+	}
+
+	groups, err := flattenGroups(db)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(i.GetID())
+	_ = d.Set("name", inventoryName(conf, i))
+	_ = d.Set("group_vars", string(files[inventory.GroupVarsFileName]))
+	_ = d.Set("group_vars_files", additionalGroupVarsFiles(files))
+	if err := d.Set("groups", groups); err != nil {
+		return diag.Errorf("failed to set groups: %s", err.Error())
+	}
+	if err := setRenderedInventory(d, db); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diags
+}
+
+// flattenGroups converts the groups of the database, with their hosts, to the groups attribute of the data source
+func flattenGroups(db *database.Database) ([]interface{}, error) {
+	var groups []interface{}
+	for _, g := range db.SortedGroups() {
+		groupVars, err := variablesToJSON(g.GetVariables())
+		if err != nil {
+			return nil, err
+		}
+
+		var hosts []interface{}
+		for _, h := range g.GetHosts() {
+			hostVars, err := variablesToJSON(util.RedactVariables(h.GetVariables(), h.GetSensitiveNames()))
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, map[string]interface{}{
+				"id":             h.GetID(),
+				"name":           h.GetName(),
+				"variables_json": hostVars,
+			})
+		}
+
+		groups = append(groups, map[string]interface{}{
+			"id":             g.GetID(),
+			"name":           g.GetName(),
+			"children":       g.GetChildren(),
+			"variables_json": groupVars,
+			"hosts":          hosts,
+		})
+	}
+	return groups, nil
+}
+
+// variablesToJSON encodes variables as a JSON object, where no variables is an empty object
+func variablesToJSON(variables map[string]interface{}) (string, error) {
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,114 @@
+package ansible
+
+import (
+	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+)
+
+const DataSourcePath = "/tmp/data_source"
+
+func TestAnsibleInventoryDataSource_Basic(t *testing.T) {
+	resourceName := "data.ansible_inventory.cluster"
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAnsiblePreCheck(t, resourceName) },
+		ProviderFactories: providerFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testAnsibleInventoryDataSourceBasic(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(resourceName, "id", "ansible_inventory.cluster", "id"),
+					resource.TestCheckResourceAttr(resourceName, "group_vars", TestGroupVarsData),
+					resource.TestCheckResourceAttr(resourceName, "groups.#", "1"),
+					resource.TestCheckResourceAttr(resourceName, "groups.0.name", "master"),
+					resource.TestCheckResourceAttr(resourceName, "groups.0.hosts.0.name", "k3s-master-1"),
+					resource.TestCheckResourceAttr(resourceName, "groups.0.hosts.0.variables_json", `{"role":"master"}`),
+					resource.TestCheckResourceAttr(resourceName, "rendered_ini", "[master]\nk3s-master-1 role=master\n\n"),
+				),
+			},
+		},
+	})
+}
+
+func TestAnsibleInventoryDataSourceRead(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(DataSourcePath, os.ModePerm))
+	defer os.RemoveAll(DataSourcePath)
+
+	i := inventory.NewInventory(DataSourcePath)
+	assert.NoError(t, i.Commit(TestGroupVarsData))
+	db := database.NewDatabase(DataSourcePath)
+	master := database.NewGroup("master")
+	master.SetVariables(map[string]interface{}{"k3s_role": "server"})
+	_ = master.AddEntity(database.NewHost("k3s-master-1", map[string]interface{}{"ansible_port": float64(22)}))
+	_ = db.AddGroup(*master)
+	cluster := database.NewGroup("cluster")
+	_ = db.AddGroup(*cluster)
+	assert.NoError(t, db.SetChildren(cluster.GetID(), []string{master.GetID()}))
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: DataSourcePath, Mutex: &sync.Mutex{}}
+	d := ansibleInventoryDataSource().TestResourceData()
+	assert.False(t, ansibleInventoryDataSourceRead(context.Background(), d, conf).HasError())
+
+	assert.Equal(t, i.GetID(), d.Id())
+	assert.Equal(t, TestGroupVarsData, d.Get("group_vars"))
+	assert.Equal(t, 2, d.Get("groups.#"))
+	assert.Equal(t, "cluster", d.Get("groups.0.name"))
+	assert.Equal(t, []interface{}{master.GetID()}, d.Get("groups.0.children"))
+	assert.Equal(t, "master", d.Get("groups.1.name"))
+	assert.Equal(t, `{"k3s_role":"server"}`, d.Get("groups.1.variables_json"))
+	assert.Equal(t, "k3s-master-1", d.Get("groups.1.hosts.0.name"))
+	assert.Equal(t, `{"ansible_port":22}`, d.Get("groups.1.hosts.0.variables_json"))
+
+	ini, _ := encodeINI(db, EncoderOptions{})
+	assert.Equal(t, string(ini), d.Get("rendered_ini"))
+	assert.Contains(t, d.Get("rendered_yaml"), "k3s-master-1:\n")
+	assert.Contains(t, d.Get("rendered_json"), `"hostvars"`)
+
+	d = ansibleInventoryDataSource().TestResourceData()
+	_ = d.Set("id", "unknown")
+	assert.True(t, ansibleInventoryDataSourceRead(context.Background(), d, conf).HasError())
+}
+
+func testAnsibleInventoryDataSourceBasic() string {
+	return `
+provider "ansible" {
+  path = "/tmp/inventory"
+}
+
+resource "ansible_inventory" "cluster" {
+  group_vars = <<-EOT
+    ---
+    k3s_version: v1.19.5+k3s1
+    ansible_user: ubuntu
+    systemd_dir: /etc/systemd/system
+    master_ip: "{{ hostvars[groups['master'][0]]['ansible_host'] | default(groups['master'][0]) }}"
+    extra_server_args: ""
+    extra_agent_args: ""
+  EOT
+}
+
+resource "ansible_group" "master" {
+  name = "master"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_host" "k3s-master-1" {
+  name = "k3s-master-1"
+  inventory = ansible_inventory.cluster.id
+  groups = [ansible_group.master.id]
+  variables = {
+    role = "master"
+  }
+}
+
+data "ansible_inventory" "cluster" {
+  id = ansible_host.k3s-master-1.inventory
+}
+`
+}
@@ -3,33 +3,36 @@ package database
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
+	"sort"
 )
 
 // Database is an internal structure to represent the contents of an Ansible hosts.ini file
 type Database struct {
-	dbFile string
-	groups map[string]Group
+	storage Storage
+	groups  map[string]Group
 }
 
-// NewDatabase creates a new database
+// NewDatabase creates a new database stored as a JSON file in the given path
 func NewDatabase(path string) *Database {
+	return NewDatabaseWithStorage(NewJSONStorage(path))
+}
+
+// NewDatabaseWithStorage creates a new database kept in the given Storage
+func NewDatabaseWithStorage(storage Storage) *Database {
 	return &Database{
-		dbFile: fmt.Sprintf("%s%sterraform-provider-ansible.json", path, string(os.PathSeparator)),
-		groups: make(map[string]Group),
+		storage: storage,
+		groups:  make(map[string]Group),
 	}
 }
 
 // Exists checks if the database exists
 func (s *Database) Exists() bool {
-	_, err := os.Stat(s.dbFile)
-	return err == nil
+	return s.storage.Exists()
 }
 
 // Path to the database file
 func (s *Database) Path() string {
-	return s.dbFile
+	return s.storage.Path()
 }
 
 // AddGroup adds a new ansible group to the database
@@ -54,9 +57,74 @@ func (s *Database) RemoveGroup(group Group) error {
 	}
 
 	delete(s.groups, group.GetID())
+
+	// remove any references to the group from its parents
+	for k := range s.groups {
+		g := s.groups[k]
+		if g.HasChild(group.GetID()) {
+			children := make([]string, 0, len(g.children))
+			for _, c := range g.children {
+				if c != group.GetID() {
+					children = append(children, c)
+				}
+			}
+			g.setChildren(children)
+			s.groups[k] = g
+		}
+	}
 	return nil
 }
 
+// SetChildren sets the child Groups of the Group with the given ID. All children must exist in the database, and a
+// Group cannot become a descendant of itself.
+func (s *Database) SetChildren(id string, children []string) error {
+	g, ok := s.groups[id]
+	if !ok {
+		return fmt.Errorf("group '%s' could not be found", id)
+	}
+
+	for _, c := range children {
+		child, ok := s.groups[c]
+		if !ok {
+			return fmt.Errorf("child group '%s' could not be found", c)
+		}
+		if c == id || s.isDescendant(c, id) {
+			return fmt.Errorf("adding group '%s' as a child of '%s' would create a cycle", child.GetName(), g.GetName())
+		}
+	}
+
+	g.setChildren(children)
+	s.groups[id] = g
+	return nil
+}
+
+// isDescendant checks if the Group with ID descendant can be reached by following the children of the Group with ID
+// ancestor
+func (s *Database) isDescendant(ancestor string, descendant string) bool {
+	visited := make(map[string]bool)
+	queue := []string{ancestor}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		g, ok := s.groups[id]
+		if !ok {
+			continue
+		}
+		for _, c := range g.children {
+			if c == descendant {
+				return true
+			}
+			queue = append(queue, c)
+		}
+	}
+	return false
+}
+
 // Group returns a Group with the specified ID in the database
 func (s *Database) Group(id string) *Group {
 	if val, ok := s.groups[id]; !ok {
@@ -76,6 +144,17 @@ func (s *Database) FindEntryByID(id string) (*Group, Entity, error) {
 	return nil, nil, fmt.Errorf("entry with GetID '%s' could not be found", id)
 }
 
+// FindGroupsByEntryID returns all Groups in the database which has the entry with the given ID as a member
+func (s *Database) FindGroupsByEntryID(id string) []*Group {
+	var groups []*Group
+	for k := range s.groups {
+		if g := s.groups[k]; g.Entry(id) != nil {
+			groups = append(groups, &g)
+		}
+	}
+	return groups
+}
+
 // FindGroupByName tries to locate a Group in the database by its name
 func (s *Database) FindGroupByName(name string) (*Group, error) {
 	for k, v := range s.groups {
@@ -87,44 +166,115 @@ func (s *Database) FindGroupByName(name string) (*Group, error) {
 	return nil, fmt.Errorf("group with name '%s' could not be found", name)
 }
 
+// FindHostByName tries to locate a Host in any Group of the database by its name
+func (s *Database) FindHostByName(name string) (*Host, error) {
+	for _, g := range s.SortedGroups() {
+		for _, h := range g.GetHosts() {
+			if h.GetName() == name {
+				return h, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("host with name '%s' could not be found", name)
+}
+
 // AllGroups returns a map of all the Groups in the database
 func (s *Database) AllGroups() *map[string]Group {
 	return &s.groups
 }
 
-// Commit the current in-memory version of the database to disk
-func (s *Database) Commit() error {
-	// Commit JSON to disk
-	if jsonString, err := json.MarshalIndent(s.groups, "", "\t"); err != nil {
-		return fmt.Errorf("failed to serialize database to '%s': %s", s.dbFile, err.Error())
-	} else {
-		if err := ioutil.WriteFile(s.dbFile, jsonString, os.ModePerm); err != nil {
-			return fmt.Errorf("failed to write database file '%s': %s", s.dbFile, err.Error())
-		}
+// SortedGroups returns all the Groups in the database ordered by name, so anything generated from the database
+// is stable between runs
+func (s *Database) SortedGroups() []Group {
+	groups := make([]Group, 0, len(s.groups))
+	for _, v := range s.groups {
+		groups = append(groups, v)
 	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].GetName() != groups[j].GetName() {
+			return groups[i].GetName() < groups[j].GetName()
+		}
+		return groups[i].GetID() < groups[j].GetID()
+	})
+	return groups
+}
 
-	return nil
+// hosts returns every Host which is a member of a Group in the database
+func (s *Database) hosts() map[string]*Host {
+	return hostsOf(s.groups)
 }
 
-// Load the database from disk into memory
-func (s *Database) Load() error {
-	if _, err := os.Stat(s.dbFile); os.IsNotExist(err) {
-		return nil
+// hostsOf returns every Host which is a member of one of the Groups
+func hostsOf(groups map[string]Group) map[string]*Host {
+	hosts := make(map[string]*Host)
+	for k := range groups {
+		g := groups[k]
+		for _, h := range g.GetHosts() {
+			hosts[h.GetID()] = h
+		}
 	}
+	return hosts
+}
 
-	s.groups = map[string]Group{}
-	jsonString, err := ioutil.ReadFile(s.dbFile)
+// Commit the current in-memory version of the database to its storage
+func (s *Database) Commit() error {
+	return s.storage.Write(s.groups)
+}
+
+// Load the database from its storage into memory
+func (s *Database) Load() error {
+	groups, err := s.storage.Read()
 	if err != nil {
-		return fmt.Errorf("failed to load database file '%s': %s", s.dbFile, err.Error())
+		s.groups = map[string]Group{}
+		return err
 	}
-
-	if len(jsonString) == 0 {
-		return nil
+	if err := checkCycles(groups); err != nil {
+		s.groups = map[string]Group{}
+		return fmt.Errorf("invalid database '%s': %s", s.Path(), err.Error())
 	}
+	s.groups = groups
+	return nil
+}
 
-	if err := json.Unmarshal(jsonString, &s.groups); err != nil {
-		return fmt.Errorf("failed to deserialize database '%s' to json: %s", s.dbFile, err.Error())
+// checkCycles checks that no group is a descendant of itself, which SetChildren prevents but a database file written
+// by a migration or edited by hand could still contain
+func checkCycles(groups map[string]Group) error {
+	db := &Database{groups: groups}
+	for id, g := range groups {
+		for _, c := range g.children {
+			if c == id || db.isDescendant(c, id) {
+				return fmt.Errorf("group '%s' is a descendant of itself", g.GetName())
+			}
+		}
 	}
-
 	return nil
 }
+
+// resolveGroups decodes the stored Groups and resolves their references to the stored Hosts, so a Host which is a
+// member of several Groups is shared between them
+func resolveGroups(groups map[string]json.RawMessage, hosts map[string]*Host) (map[string]Group, error) {
+	result := make(map[string]Group)
+	for k, v := range groups {
+		g := Group{}
+		if err := json.Unmarshal(v, &g); err != nil {
+			return nil, err
+		}
+
+		refs := &struct {
+			Hosts []string `json:"hosts"`
+		}{}
+		if err := json.Unmarshal(v, refs); err != nil {
+			return nil, err
+		}
+		for _, id := range refs.Hosts {
+			h, ok := hosts[id]
+			if !ok {
+				return nil, fmt.Errorf("group '%s' references unknown host '%s'", g.GetName(), id)
+			}
+			g.UpdateEntity(h)
+		}
+
+		result[k] = g
+	}
+	return result, nil
+}
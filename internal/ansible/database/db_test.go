@@ -1,8 +1,12 @@
 package database
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"os"
 	"testing"
 )
 
@@ -26,10 +30,9 @@ func TestCreateNewDatabase(t *testing.T) {
 	_ = node.AddEntity(NewHost("192.168.0.185", nil))
 	_ = db.AddGroup(*node)
 
-	groupInGroup := NewGroup("k3s_cluster:children")
-	_ = groupInGroup.AddEntity(NewGroup("master"))
-	_ = groupInGroup.AddEntity(NewGroup("node"))
+	groupInGroup := NewGroup("k3s_cluster")
 	_ = db.AddGroup(*groupInGroup)
+	assert.NoError(t, db.SetChildren(groupInGroup.GetID(), []string{master.GetID(), node.GetID()}))
 
 	if err := db.Commit(); err != nil {
 		assert.Fail(t, err.Error())
@@ -59,8 +62,196 @@ func TestCreateNewDatabase(t *testing.T) {
 	assert.Equal(t, "node", g2.GetName())
 	assert.Equal(t, 5, len(g2.entries))
 
-	g3, err := db2.FindGroupByName("k3s_cluster:children")
+	g3, err := db2.FindGroupByName("k3s_cluster")
 	assert.Nil(t, err)
-	assert.Equal(t, "k3s_cluster:children", g3.GetName())
-	assert.Equal(t, 2, len(g3.entries))
+	assert.Equal(t, "k3s_cluster", g3.GetName())
+	assert.Equal(t, 0, len(g3.entries))
+	assert.True(t, g3.HasChild(g1.GetID()))
+	assert.True(t, g3.HasChild(g2.GetID()))
+}
+
+const LegacyDbPath = "/tmp/legacy"
+
+const LegacyDbData = `{
+	"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001": {
+		"id": "0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001",
+		"type": "GROUP",
+		"name": "master",
+		"entries": {
+			"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a002": "{\"id\":\"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a002\",\"type\":\"HOST\",\"name\":\"192.168.0.180\",\"variables\":{\"role\":\"master\"}}"
+		}
+	}
+}`
+
+func TestHostInMultipleGroups(t *testing.T) {
+	db := NewDatabase(DbPath)
+
+	h := NewHost("192.168.0.180", map[string]interface{}{"role": "master"})
+	master := NewGroup("master")
+	_ = master.AddEntity(h)
+	_ = db.AddGroup(*master)
+
+	monitoring := NewGroup("monitoring")
+	_ = monitoring.AddEntity(h)
+	_ = db.AddGroup(*monitoring)
+
+	if err := db.Commit(); err != nil {
+		assert.Fail(t, err.Error())
+	}
+
+	db2 := NewDatabase(DbPath)
+	if err := db2.Load(); err != nil {
+		assert.Fail(t, fmt.Sprintf("failed load db file: %s", err.Error()))
+	}
+
+	assert.Equal(t, 1, len(db2.hosts()))
+	groups := db2.FindGroupsByEntryID(h.GetID())
+	assert.Equal(t, 2, len(groups))
+
+	// both groups reference the same host, so updating it through one group is visible through the other
+	_, e, err := db2.FindEntryByID(h.GetID())
+	assert.Nil(t, err)
+	e.SetName("k3s-master-1")
+	for _, g := range groups {
+		assert.Equal(t, "k3s-master-1", g.Entry(h.GetID()).GetName())
+	}
+}
+
+func TestLoadLegacyDatabase(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(LegacyDbPath, os.ModePerm))
+	defer os.RemoveAll(LegacyDbPath)
+
+	db := NewDatabase(LegacyDbPath)
+	assert.NoError(t, os.WriteFile(db.Path(), []byte(LegacyDbData), os.ModePerm))
+	assert.NoError(t, db.Load())
+
+	g, err := db.FindGroupByName("master")
+	assert.Nil(t, err)
+	e, err := g.FindEntityByName("192.168.0.180")
+	assert.Nil(t, err)
+	assert.Equal(t, "master", e.(*Host).variables["role"])
+
+	// committing writes the current format, which must load back to the same content
+	assert.NoError(t, db.Commit())
+	db2 := NewDatabase(LegacyDbPath)
+	assert.NoError(t, db2.Load())
+	assert.Equal(t, 1, len(db2.hosts()))
+	assert.Equal(t, 1, len(db2.FindGroupsByEntryID(e.GetID())))
+}
+
+func TestGroupVariables(t *testing.T) {
+	db := NewDatabase(DbPath)
+
+	master := NewGroup("master")
+	master.SetVariables(map[string]interface{}{"k3s_role": "server"})
+	_ = db.AddGroup(*master)
+
+	if err := db.Commit(); err != nil {
+		assert.Fail(t, err.Error())
+	}
+
+	db2 := NewDatabase(DbPath)
+	if err := db2.Load(); err != nil {
+		assert.Fail(t, fmt.Sprintf("failed load db file: %s", err.Error()))
+	}
+
+	g := db2.Group(master.GetID())
+	assert.NotNil(t, g)
+	v, err := g.GetVariable("k3s_role")
+	assert.Nil(t, err)
+	assert.Equal(t, "server", v)
+}
+
+func TestGroupChildrenCycles(t *testing.T) {
+	db := NewDatabase(DbPath)
+
+	cluster := NewGroup("k3s_cluster")
+	_ = db.AddGroup(*cluster)
+	master := NewGroup("master")
+	_ = db.AddGroup(*master)
+	leader := NewGroup("leader")
+	_ = db.AddGroup(*leader)
+
+	assert.NoError(t, db.SetChildren(cluster.GetID(), []string{master.GetID()}))
+	assert.NoError(t, db.SetChildren(master.GetID(), []string{leader.GetID()}))
+
+	// a group can neither be its own child nor a child of one of its descendants
+	assert.Error(t, db.SetChildren(leader.GetID(), []string{leader.GetID()}))
+	assert.Error(t, db.SetChildren(leader.GetID(), []string{cluster.GetID()}))
+	assert.Error(t, db.SetChildren(cluster.GetID(), []string{"unknown"}))
+
+	// removing a group removes it from the children of its parents
+	assert.NoError(t, db.RemoveGroup(*master))
+	assert.False(t, db.Group(cluster.GetID()).HasChild(master.GetID()))
+}
+
+func TestTypedHostVariables(t *testing.T) {
+	db := NewDatabase(DbPath)
+
+	variables := make(map[string]interface{})
+	variables["ansible_port"] = 22
+	variables["enabled"] = true
+	variables["ports"] = []interface{}{80, 443}
+	variables["labels"] = map[string]interface{}{"zone": "eu-west-1a"}
+	master := NewGroup("master")
+	h := NewHost("192.168.0.180", variables)
+	_ = master.AddEntity(h)
+	_ = db.AddGroup(*master)
+
+	if err := db.Commit(); err != nil {
+		assert.Fail(t, err.Error())
+	}
+
+	db2 := NewDatabase(DbPath)
+	if err := db2.Load(); err != nil {
+		assert.Fail(t, fmt.Sprintf("failed load db file: %s", err.Error()))
+	}
+
+	_, e, err := db2.FindEntryByID(h.GetID())
+	assert.Nil(t, err)
+	vars := e.(*Host).GetVariables()
+	assert.Equal(t, float64(22), vars["ansible_port"])
+	assert.Equal(t, true, vars["enabled"])
+	assert.Equal(t, []interface{}{float64(80), float64(443)}, vars["ports"])
+	assert.Equal(t, map[string]interface{}{"zone": "eu-west-1a"}, vars["labels"])
+}
+
+const RecoveryDbPath = "/tmp/recovery"
+
+func TestRecoverFromBackup(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(RecoveryDbPath, os.ModePerm))
+	defer os.RemoveAll(RecoveryDbPath)
+
+	db := NewDatabase(RecoveryDbPath)
+	_ = db.AddGroup(*NewGroup("master"))
+	assert.NoError(t, db.Commit())
+	_ = db.AddGroup(*NewGroup("node"))
+	assert.NoError(t, db.Commit())
+
+	// a truncated database falls back to the last good copy, with a warning naming both files
+	var out bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&out)
+	defer func() { log.Logger = logger }()
+	assert.NoError(t, os.WriteFile(db.Path(), []byte(`{"groups": {`), os.ModePerm))
+	db2 := NewDatabase(RecoveryDbPath)
+	assert.NoError(t, db2.Load())
+	assert.Equal(t, 1, len(db2.groups))
+	_, err := db2.FindGroupByName("master")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), `"level":"warn"`)
+	assert.Contains(t, out.String(), db.Path())
+	assert.Contains(t, out.String(), db.storage.(*jsonStorage).backupFile)
+
+	// a corrupt database file is never kept as the last good copy
+	assert.NoError(t, db2.Commit())
+	assert.NoError(t, os.WriteFile(db.Path(), []byte{}, os.ModePerm))
+	db3 := NewDatabase(RecoveryDbPath)
+	assert.NoError(t, db3.Load())
+	assert.Equal(t, 1, len(db3.groups))
+
+	// without a good copy the error is reported
+	assert.NoError(t, os.Remove(db.storage.(*jsonStorage).backupFile))
+	assert.NoError(t, os.WriteFile(db.Path(), []byte(`{"groups": {`), os.ModePerm))
+	assert.Error(t, NewDatabase(RecoveryDbPath).Load())
 }
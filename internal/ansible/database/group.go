@@ -3,22 +3,26 @@ package database
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"sort"
 )
 
 // Group is a representation of a group in the Ansible hosts.ini file
 type Group struct {
-	id      Identity
-	name    string
-	entries map[string]Entity
+	id        Identity
+	name      string
+	entries   map[string]Entity
+	children  []string
+	variables map[string]interface{}
 }
 
 // NewGroup returns a new Group with the given name
 func NewGroup(name string) *Group {
 	return &Group{
-		id:      *NewIdentity(),
-		name:    name,
-		entries: make(map[string]Entity),
+		id:        *NewIdentity(),
+		name:      name,
+		entries:   make(map[string]Entity),
+		children:  []string{},
+		variables: make(map[string]interface{}),
 	}
 }
 
@@ -37,6 +41,68 @@ func (s *Group) SetName(name string) {
 	s.name = name
 }
 
+// GetChildren returns the IDs of the child Groups of the Group
+func (s *Group) GetChildren() []string {
+	return s.children
+}
+
+// HasChild checks if the Group with the given ID is a child of the Group
+func (s *Group) HasChild(id string) bool {
+	for _, c := range s.children {
+		if c == id {
+			return true
+		}
+	}
+	return false
+}
+
+// setChildren replaces the child Groups of the Group. Use Database.SetChildren to validate the group hierarchy.
+func (s *Group) setChildren(children []string) {
+	ids := make([]string, 0, len(children))
+	seen := make(map[string]bool)
+	for _, c := range children {
+		if !seen[c] {
+			seen[c] = true
+			ids = append(ids, c)
+		}
+	}
+	sort.Strings(ids)
+	s.children = ids
+}
+
+// GetVariableNames returns the sorted name of all variables set for the Group
+func (s *Group) GetVariableNames() []string {
+	keys := make([]string, 0, len(s.variables))
+	for k := range s.variables {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetVariables returns the variable map of the Group
+func (s *Group) GetVariables() map[string]interface{} {
+	return s.variables
+}
+
+// SetVariables replaces all variables of the Group
+func (s *Group) SetVariables(variables map[string]interface{}) {
+	vars := variables
+	if vars == nil {
+		vars = make(map[string]interface{})
+	}
+	s.variables = vars
+}
+
+// GetVariable returns a variable for the Group
+func (s *Group) GetVariable(name string) (interface{}, error) {
+	if val, ok := s.variables[name]; ok {
+		return val, nil
+	}
+
+	return nil, fmt.Errorf("variable '%s' not defined for group '%s'", name, s.name)
+}
+
 // Type returns the Entity name
 func (s *Group) Type() string {
 	return "GROUP"
@@ -90,12 +156,19 @@ func (s *Group) GetEntriesAsString() []string {
 	return stringEntries
 }
 
-// GetEntities returns the name of all Entity in a group
+// GetEntities returns the IDs of all Entity in a group, ordered by the name of the Entity
 func (s *Group) GetEntities() []string {
 	keys := make([]string, 0, len(s.entries))
 	for k := range s.entries {
 		keys = append(keys, k)
 	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := s.entries[keys[i]], s.entries[keys[j]]
+		if a.GetName() != b.GetName() {
+			return a.GetName() < b.GetName()
+		}
+		return keys[i] < keys[j]
+	})
 
 	return keys
 }
@@ -110,32 +183,44 @@ func (s *Group) FindEntityByName(name string) (Entity, error) {
 	return nil, fmt.Errorf("entity '%s' not found in group", name)
 }
 
-func entriesMapToStringMap(entries map[string]Entity) map[string]string {
-	stringMap := make(map[string]string)
-	for k, v := range entries {
-		if !util.CanMarshal(v) {
-			continue
+// GetHosts returns all Host members of the Group, ordered by name
+func (s *Group) GetHosts() []*Host {
+	var hosts []*Host
+	for _, k := range s.GetEntities() {
+		if h, ok := s.entries[k].(*Host); ok {
+			hosts = append(hosts, h)
 		}
+	}
+	return hosts
+}
 
-		if s, err := json.Marshal(v); err == nil {
-			stringMap[k] = string(s)
+// hostIDs returns the sorted IDs of the Host members of the Group
+func (s *Group) hostIDs() []string {
+	ids := make([]string, 0, len(s.entries))
+	for k := range s.entries {
+		if _, ok := s.entries[k].(*Host); ok {
+			ids = append(ids, k)
 		}
 	}
-	return stringMap
+	sort.Strings(ids)
+	return ids
 }
 
-// MarshalJSON marshals a Group to JSON
+// MarshalJSON marshals a Group to JSON. Hosts are stored once in the database and only referenced from the Group by
+// their ID.
 func (s Group) MarshalJSON() ([]byte, error) {
 	aux := &struct {
-		ID      Identity          `json:"id"`
-		Type    string            `json:"type"`
-		Name    string            `json:"name"`
-		Entries map[string]string `json:"entries"`
+		ID        Identity               `json:"id"`
+		Name      string                 `json:"name"`
+		Hosts     []string               `json:"hosts"`
+		Children  []string               `json:"children"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
 	}{
-		ID:      s.id,
-		Type:    s.Type(),
-		Name:    s.name,
-		Entries: entriesMapToStringMap(s.entries),
+		ID:        s.id,
+		Name:      s.name,
+		Hosts:     s.hostIDs(),
+		Children:  s.children,
+		Variables: s.variables,
 	}
 
 	if jsonString, err := json.MarshalIndent(aux, "", "\t"); err != nil {
@@ -145,13 +230,14 @@ func (s Group) MarshalJSON() ([]byte, error) {
 	}
 }
 
-// UnmarshalJSON unmarshals Group from a JSON byte array
+// UnmarshalJSON unmarshals Group from a JSON byte array. Host references are resolved by the Database when it is
+// loaded.
 func (s *Group) UnmarshalJSON(data []byte) error {
 	aux := &struct {
-		ID      Identity          `json:"id"`
-		Type    string            `json:"type"`
-		Name    string            `json:"name"`
-		Entries map[string]string `json:"entries"`
+		ID        Identity               `json:"id"`
+		Name      string                 `json:"name"`
+		Children  []string               `json:"children"`
+		Variables map[string]interface{} `json:"variables"`
 	}{}
 
 	if err := json.Unmarshal(data, &aux); err != nil {
@@ -161,31 +247,8 @@ func (s *Group) UnmarshalJSON(data []byte) error {
 	s.id = aux.ID
 	s.name = aux.Name
 	s.entries = make(map[string]Entity)
-
-	for _, v := range aux.Entries {
-		typeAux := &struct {
-			Type string
-		}{}
-
-		if err := json.Unmarshal([]byte(v), &typeAux); err != nil {
-			return err
-		}
-
-		switch typeAux.Type {
-		case "HOST":
-			h := &Host{}
-			if err := json.Unmarshal([]byte(v), h); err != nil {
-				return err
-			}
-			_ = s.AddEntity(h)
-		case "GROUP":
-			g := &Group{}
-			if err := json.Unmarshal([]byte(v), g); err != nil {
-				return err
-			}
-			_ = s.AddEntity(g)
-		}
-	}
+	s.setChildren(aux.Children)
+	s.SetVariables(aux.Variables)
 
 	return nil
 }
@@ -3,6 +3,7 @@ package database
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 )
 
 // Host represents an Ansible host in the hosts.ini file
@@ -10,6 +11,7 @@ type Host struct {
 	id        Identity
 	name      string
 	variables map[string]interface{}
+	sensitive []string
 }
 
 // NewHost creates a new Host with the given name, where name is IP or hostname
@@ -41,12 +43,13 @@ func (s *Host) SetName(name string) {
 	s.name = name
 }
 
-// GetVariableNames returns the name of all variables set for a host
+// GetVariableNames returns the sorted name of all variables set for a host
 func (s *Host) GetVariableNames() []string {
 	keys := make([]string, 0, len(s.variables))
 	for k := range s.variables {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 	return keys
 }
 
@@ -64,6 +67,32 @@ func (s *Host) GetVariable(name string) (interface{}, error) {
 	return nil, fmt.Errorf("variable '%s' not defined for host '%s'", name, s.name)
 }
 
+// SetVariables replaces all variables of a host
+func (s *Host) SetVariables(variables map[string]interface{}) {
+	vars := variables
+	if vars == nil {
+		vars = make(map[string]interface{})
+	}
+	s.variables = vars
+}
+
+// GetSensitiveNames returns the sorted names of the variables of a host which are sensitive
+func (s *Host) GetSensitiveNames() []string {
+	return s.sensitive
+}
+
+// SetSensitiveNames replaces the names of the variables of a host which are sensitive, so they are kept out of the
+// plan and logs. The values are stored encrypted, except values stored in plain text by earlier versions.
+func (s *Host) SetSensitiveNames(names []string) {
+	if len(names) == 0 {
+		s.sensitive = nil
+		return
+	}
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	s.sensitive = sorted
+}
+
 // SetVariable sets a variable for a host
 func (s *Host) SetVariable(name string, val interface{}) {
 	s.variables[name] = val
@@ -78,14 +107,14 @@ func (s *Host) Type() string {
 func (s Host) MarshalJSON() ([]byte, error) {
 	aux := &struct {
 		ID        Identity               `json:"id"`
-		Type      string                 `json:"type"`
 		Name      string                 `json:"name"`
 		Variables map[string]interface{} `json:"variables"`
+		Sensitive []string               `json:"sensitive,omitempty"`
 	}{
 		ID:        s.id,
-		Type:      s.Type(),
 		Name:      s.name,
 		Variables: s.variables,
+		Sensitive: s.sensitive,
 	}
 
 	if jsonString, err := json.MarshalIndent(aux, "", "\t"); err != nil {
@@ -99,9 +128,9 @@ func (s Host) MarshalJSON() ([]byte, error) {
 func (s *Host) UnmarshalJSON(data []byte) error {
 	aux := &struct {
 		ID        Identity               `json:"id"`
-		Type      string                 `json:"type"`
 		Name      string                 `json:"name"`
 		Variables map[string]interface{} `json:"variables"`
+		Sensitive []string               `json:"sensitive"`
 	}{}
 
 	if err := json.Unmarshal(data, &aux); err != nil {
@@ -110,7 +139,8 @@ func (s *Host) UnmarshalJSON(data []byte) error {
 
 	s.id = aux.ID
 	s.name = aux.Name
-	s.variables = aux.Variables
+	s.SetVariables(aux.Variables)
+	s.SetSensitiveNames(aux.Sensitive)
 
 	return nil
 }
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// currentVersion is the version of the on-disk format written by Commit
+const currentVersion = 2
+
+// migration upgrades the contents of a database file from one version of the on-disk format to the next
+type migration func(data []byte) ([]byte, error)
+
+// migrations upgrade older database files on Load, where migrations[n] upgrades version n to version n+1.
+//
+//   - version 0 is a bare map of groups, with every member of a group stored as a JSON string in its entries
+//   - version 1 stores every host once next to the groups, but has no version field and keeps other members of a
+//     group as JSON strings
+//   - version 2 adds the version field and stores a group as its host IDs, child group IDs and variables
+var migrations = []migration{
+	migrateV0ToV1,
+	migrateV1ToV2,
+}
+
+// unsupportedVersionError is returned for a database file written by a newer version of the provider, which must
+// not be replaced by an older backup or overwritten
+type unsupportedVersionError struct {
+	version int
+}
+
+func (e unsupportedVersionError) Error() string {
+	return fmt.Sprintf("database version %d is newer than the supported version %d, upgrade the provider", e.version, currentVersion)
+}
+
+// fileVersion returns the version of the on-disk format of a database file
+func fileVersion(data []byte) (int, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return 0, err
+	}
+
+	raw, ok := top["version"]
+	if !ok {
+		if _, ok := top["groups"]; ok {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid database version '%s'", string(raw))
+	}
+	return version, nil
+}
+
+// migrate upgrades the contents of a database file to the current version of the on-disk format, and returns the
+// version it was upgraded from
+func migrate(data []byte) ([]byte, int, error) {
+	version, err := fileVersion(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > currentVersion {
+		return nil, version, unsupportedVersionError{version: version}
+	}
+
+	for v := version; v < currentVersion; v++ {
+		if data, err = migrations[v](data); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate database from version %d to %d: %s", v, v+1, err.Error())
+		}
+	}
+	return data, version, nil
+}
+
+// entryType returns the type of a group member stored as a JSON string by versions 0 and 1
+func entryType(entry string) (string, error) {
+	aux := &struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal([]byte(entry), aux); err != nil {
+		return "", err
+	}
+	return aux.Type, nil
+}
+
+type groupV0 struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Entries   map[string]string `json:"entries"`
+	Children  []string          `json:"children,omitempty"`
+	Variables json.RawMessage   `json:"variables,omitempty"`
+}
+
+type groupV1 struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Entries   map[string]string `json:"entries"`
+	Hosts     []string          `json:"hosts"`
+	Children  []string          `json:"children"`
+	Variables json.RawMessage   `json:"variables,omitempty"`
+}
+
+type fileV1 struct {
+	Groups map[string]groupV1         `json:"groups"`
+	Hosts  map[string]json.RawMessage `json:"hosts"`
+}
+
+type fileV2 struct {
+	Version int                        `json:"version"`
+	Groups  map[string]json.RawMessage `json:"groups"`
+	Hosts   map[string]json.RawMessage `json:"hosts"`
+}
+
+// migrateV0ToV1 moves the hosts out of the groups, so a host which is a member of several groups is stored once
+func migrateV0ToV1(data []byte) ([]byte, error) {
+	var groups map[string]groupV0
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, err
+	}
+
+	file := fileV1{Groups: make(map[string]groupV1), Hosts: make(map[string]json.RawMessage)}
+	for k, g := range groups {
+		group := groupV1{
+			ID:        g.ID,
+			Type:      g.Type,
+			Name:      g.Name,
+			Entries:   make(map[string]string),
+			Hosts:     []string{},
+			Children:  g.Children,
+			Variables: g.Variables,
+		}
+		for id, entry := range g.Entries {
+			t, err := entryType(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry '%s' in group '%s': %s", id, g.Name, err.Error())
+			}
+			if t != "HOST" {
+				group.Entries[id] = entry
+				continue
+			}
+			file.Hosts[id] = json.RawMessage(entry)
+			group.Hosts = append(group.Hosts, id)
+		}
+		sort.Strings(group.Hosts)
+		file.Groups[k] = group
+	}
+	return json.Marshal(file)
+}
+
+// legacyChildrenSuffix marks the groups which older versions used to nest groups, by naming the parent group
+// "<parent>:children" and adding copies of the child groups, with new IDs, to its entries
+const legacyChildrenSuffix = ":children"
+
+// migrateV1ToV2 adds the version field and replaces the remaining entries of a group. Groups nested as entries
+// become child groups, matched by ID or else by name, as the nested entries are usually copies of the real groups
+// with new IDs. A "<parent>:children" group becomes the group "<parent>". Nested entries which do not match exactly
+// one group fail the migration, as they are exported as children and must not be lost.
+func migrateV1ToV2(data []byte) ([]byte, error) {
+	var file fileV1
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	result := fileV2{Version: 2, Groups: make(map[string]json.RawMessage), Hosts: make(map[string]json.RawMessage)}
+	for id, h := range file.Hosts {
+		host := &struct {
+			ID        string          `json:"id"`
+			Name      string          `json:"name"`
+			Variables json.RawMessage `json:"variables,omitempty"`
+		}{}
+		if err := json.Unmarshal(h, host); err != nil {
+			return nil, fmt.Errorf("invalid host '%s': %s", id, err.Error())
+		}
+		data, err := json.Marshal(host)
+		if err != nil {
+			return nil, err
+		}
+		result.Hosts[id] = data
+	}
+
+	names := make(map[string]string, len(file.Groups))
+	byName := make(map[string][]string, len(file.Groups))
+	for k, g := range file.Groups {
+		name := strings.TrimSuffix(g.Name, legacyChildrenSuffix)
+		names[k] = name
+		byName[name] = append(byName[name], k)
+	}
+	for name, ids := range byName {
+		if len(ids) > 1 {
+			return nil, fmt.Errorf("found %d groups named '%s', where groups named '%s%s' are migrated to '%s'", len(ids), name, name, legacyChildrenSuffix, name)
+		}
+	}
+
+	for k, g := range file.Groups {
+		children := g.Children
+		seen := make(map[string]bool, len(children))
+		for _, c := range children {
+			seen[c] = true
+		}
+		for id, entry := range g.Entries {
+			aux := &struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			}{}
+			if err := json.Unmarshal([]byte(entry), aux); err != nil {
+				return nil, fmt.Errorf("invalid entry '%s' in group '%s': %s", id, g.Name, err.Error())
+			}
+			if aux.Type != "GROUP" {
+				return nil, fmt.Errorf("unexpected entry '%s' of type '%s' in group '%s'", id, aux.Type, g.Name)
+			}
+			child := id
+			if _, ok := file.Groups[id]; !ok {
+				matches := byName[strings.TrimSuffix(aux.Name, legacyChildrenSuffix)]
+				if len(matches) != 1 {
+					return nil, fmt.Errorf("nested group '%s' in group '%s' does not match any group", aux.Name, g.Name)
+				}
+				child = matches[0]
+			}
+			if child == k {
+				return nil, fmt.Errorf("group '%s' cannot be nested in itself", g.Name)
+			}
+			if !seen[child] {
+				seen[child] = true
+				children = append(children, child)
+			}
+		}
+		sort.Strings(children)
+
+		hosts := g.Hosts
+		if hosts == nil {
+			hosts = []string{}
+		}
+		data, err := json.Marshal(&struct {
+			ID        string          `json:"id"`
+			Name      string          `json:"name"`
+			Hosts     []string        `json:"hosts"`
+			Children  []string        `json:"children"`
+			Variables json.RawMessage `json:"variables,omitempty"`
+		}{
+			ID:        g.ID,
+			Name:      names[k],
+			Hosts:     hosts,
+			Children:  children,
+			Variables: g.Variables,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Groups[k] = data
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+const MigrationDbPath = "/tmp/migration"
+
+// VersionOneDbData is a database written before the version field was added, with a group nested in the entries of
+// another group
+const VersionOneDbData = `{
+	"groups": {
+		"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001": {
+			"id": "0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001",
+			"type": "GROUP",
+			"name": "master",
+			"entries": {},
+			"hosts": ["0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a002"],
+			"children": [],
+			"variables": {"k3s_role": "server"}
+		},
+		"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a003": {
+			"id": "0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a003",
+			"type": "GROUP",
+			"name": "k3s_cluster",
+			"entries": {
+				"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001": "{\"id\":\"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001\",\"type\":\"GROUP\",\"name\":\"master\",\"entries\":{}}"
+			},
+			"hosts": [],
+			"children": null
+		}
+	},
+	"hosts": {
+		"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a002": {
+			"id": "0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a002",
+			"type": "HOST",
+			"name": "192.168.0.180",
+			"variables": {"ansible_port": 22}
+		}
+	}
+}`
+
+// BaselineDbData is a database written by the first release, where the parent group named k3s_cluster:children
+// holds a copy of the master group with a new ID
+const BaselineDbData = `{
+	"e8a4b03f-d0b9-4be1-8c1a-4078de161f6a": {
+		"id": "e8a4b03f-d0b9-4be1-8c1a-4078de161f6a",
+		"type": "GROUP",
+		"name": "k3s_cluster:children",
+		"entries": {
+			"dda01ff0-1b61-434b-ac30-1985524adb8b": "{\"id\":\"dda01ff0-1b61-434b-ac30-1985524adb8b\",\"type\":\"GROUP\",\"name\":\"master\",\"entries\":{}}"
+		}
+	},
+	"f9b6a665-51de-400d-8c5f-cfaa7d723c6b": {
+		"id": "f9b6a665-51de-400d-8c5f-cfaa7d723c6b",
+		"type": "GROUP",
+		"name": "master",
+		"entries": {
+			"dae08743-192d-4840-ba87-ebde617f4278": "{\"id\":\"dae08743-192d-4840-ba87-ebde617f4278\",\"type\":\"HOST\",\"name\":\"k3s-master-1\",\"variables\":{\"ansible_port\":\"22\"}}"
+		}
+	}
+}`
+
+func TestFileVersion(t *testing.T) {
+	for data, expected := range map[string]int{
+		LegacyDbData:                   0,
+		`{}`:                           0,
+		VersionOneDbData:               1,
+		`{"version": 2, "groups": {}}`: 2,
+	} {
+		v, err := fileVersion([]byte(data))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, v)
+	}
+
+	for _, data := range []string{`{"version": "2"}`, `{"version": 0}`, `[]`} {
+		_, err := fileVersion([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestMigrateToCurrentVersion(t *testing.T) {
+	for _, data := range []string{LegacyDbData, BaselineDbData, VersionOneDbData} {
+		migrated, _, err := migrate([]byte(data))
+		assert.NoError(t, err)
+
+		v, err := fileVersion(migrated)
+		assert.NoError(t, err)
+		assert.Equal(t, currentVersion, v)
+		assert.NotContains(t, string(migrated), `"entries"`)
+		assert.NotContains(t, string(migrated), `"type"`)
+	}
+
+	_, version, err := migrate([]byte(`{"version": 99, "groups": {}}`))
+	assert.Equal(t, 99, version)
+	assert.Equal(t, unsupportedVersionError{version: 99}, err)
+}
+
+func TestUpgradeDatabaseOnCommit(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(MigrationDbPath, os.ModePerm))
+	defer os.RemoveAll(MigrationDbPath)
+
+	db := NewDatabase(MigrationDbPath)
+	assert.NoError(t, os.WriteFile(db.Path(), []byte(VersionOneDbData), os.ModePerm))
+	assert.NoError(t, db.Load())
+
+	// groups nested as entries become children
+	cluster, err := db.FindGroupByName("k3s_cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0b1d2c7e-8b27-4c1e-9d59-3d2ef6c0a001"}, cluster.GetChildren())
+	master, err := db.FindGroupByName("master")
+	assert.NoError(t, err)
+	assert.Equal(t, "server", master.GetVariables()["k3s_role"])
+	h, err := db.FindHostByName("192.168.0.180")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(22), h.GetVariables()["ansible_port"])
+
+	// loading never writes, as readers such as the dynamic inventory script do not hold the inventory lock
+	data, err := os.ReadFile(db.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, VersionOneDbData, string(data))
+	assert.NoFileExists(t, db.storage.(*jsonStorage).backupFile)
+
+	// the upgraded database is written by the next commit, keeping the original as the backup
+	assert.NoError(t, db.Commit())
+	data, err = os.ReadFile(db.Path())
+	assert.NoError(t, err)
+	aux := &databaseFile{}
+	assert.NoError(t, json.Unmarshal(data, aux))
+	assert.Equal(t, currentVersion, aux.Version)
+	backup, err := os.ReadFile(db.storage.(*jsonStorage).backupFile)
+	assert.NoError(t, err)
+	assert.Equal(t, VersionOneDbData, string(backup))
+
+	db2 := NewDatabase(MigrationDbPath)
+	assert.NoError(t, db2.Load())
+	assert.Equal(t, 2, len(db2.groups))
+	assert.Equal(t, 1, len(db2.hosts()))
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(MigrationDbPath, os.ModePerm))
+	defer os.RemoveAll(MigrationDbPath)
+
+	db := NewDatabase(MigrationDbPath)
+	assert.NoError(t, os.WriteFile(db.Path(), []byte(BaselineDbData), os.ModePerm))
+	assert.NoError(t, db.Load())
+
+	// the k3s_cluster:children group becomes k3s_cluster, with the real master group as its child
+	assert.Equal(t, 2, len(db.groups))
+	cluster, err := db.FindGroupByName("k3s_cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"f9b6a665-51de-400d-8c5f-cfaa7d723c6b"}, cluster.GetChildren())
+	h, err := db.FindHostByName("k3s-master-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "22", h.GetVariables()["ansible_port"])
+}
+
+func TestMigrateInvalidNestedGroups(t *testing.T) {
+	nested := func(id string, name string) string {
+		entry, _ := json.Marshal(map[string]interface{}{"id": id, "type": "GROUP", "name": name, "entries": map[string]string{}})
+		return string(entry)
+	}
+	group := func(id string, name string, entries map[string]string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "type": "GROUP", "name": name, "entries": entries}
+	}
+
+	for msg, groups := range map[string]map[string]interface{}{
+		"does not match any group": {
+			"a": group("a", "k3s_cluster:children", map[string]string{"x": nested("x", "removed")}),
+		},
+		"nested in itself": {
+			"a": group("a", "k3s_cluster:children", map[string]string{"x": nested("x", "k3s_cluster")}),
+		},
+		"found 2 groups named 'k3s_cluster'": {
+			"a": group("a", "k3s_cluster:children", map[string]string{}),
+			"b": group("b", "k3s_cluster", map[string]string{}),
+		},
+	} {
+		data, _ := json.Marshal(groups)
+		_, _, err := migrate(data)
+		if assert.Error(t, err, msg) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+
+	// groups nested in each other are migrated, but the cycle is caught when the database is loaded
+	assert.NoError(t, os.MkdirAll(MigrationDbPath, os.ModePerm))
+	defer os.RemoveAll(MigrationDbPath)
+	data, _ := json.Marshal(map[string]interface{}{
+		"a": group("a", "web:children", map[string]string{"x": nested("x", "db")}),
+		"b": group("b", "db:children", map[string]string{"y": nested("y", "web")}),
+	})
+	_, _, err := migrate(data)
+	assert.NoError(t, err)
+	db := NewDatabase(MigrationDbPath)
+	assert.NoError(t, os.WriteFile(db.Path(), data, os.ModePerm))
+	err = db.Load()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "is a descendant of itself")
+	}
+}
+
+func TestLoadNewerDatabaseVersion(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(MigrationDbPath, os.ModePerm))
+	defer os.RemoveAll(MigrationDbPath)
+
+	db := NewDatabase(MigrationDbPath)
+	_ = db.AddGroup(*NewGroup("master"))
+	assert.NoError(t, db.Commit())
+	assert.NoError(t, db.Commit())
+
+	// a database from a newer provider is never replaced by the backup
+	assert.NoError(t, os.WriteFile(db.Path(), []byte(`{"version": 99, "groups": {}, "hosts": {}}`), os.ModePerm))
+	err := NewDatabase(MigrationDbPath).Load()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "upgrade the provider")
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// StorageJSON keeps the database in a single JSON file, which is rewritten on every change
+	StorageJSON = "json"
+	// StorageBolt keeps the database in an embedded bbolt store, where only changed groups and hosts are written
+	StorageBolt = "bolt"
+)
+
+// Storages lists the supported kinds of Storage
+var Storages = []string{StorageJSON, StorageBolt}
+
+// Storage keeps the contents of a Database between runs of the provider
+type Storage interface {
+	// Path returns the path of the file the database is stored in
+	Path() string
+	// Exists checks if the database has been written to the storage
+	Exists() bool
+	// Read returns all the Groups in the storage, with their Hosts
+	Read() (map[string]Group, error)
+	// Write replaces the contents of the storage with the Groups and their Hosts in a single transaction
+	Write(groups map[string]Group) error
+}
+
+// NewStorage returns the Storage of the given kind for a database in the given path
+func NewStorage(path string, kind string) (Storage, error) {
+	switch kind {
+	case StorageJSON, "":
+		return NewJSONStorage(path), nil
+	case StorageBolt:
+		return NewBoltStorage(path), nil
+	default:
+		return nil, fmt.Errorf("unknown database storage '%s'", kind)
+	}
+}
+
+// Open returns the database in the given path. A database which already exists is opened with the storage it was
+// written with, while a new database uses the given kind of storage.
+func Open(path string, kind string) (*Database, error) {
+	for _, k := range Storages {
+		storage, _ := NewStorage(path, k)
+		if _, err := os.Stat(storage.Path()); err == nil {
+			return NewDatabaseWithStorage(storage), nil
+		}
+	}
+
+	storage, err := NewStorage(path, kind)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabaseWithStorage(storage), nil
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	boltMetaBucket   = []byte("meta")
+	boltGroupsBucket = []byte("groups")
+	boltHostsBucket  = []byte("hosts")
+	boltVersionKey   = []byte("version")
+)
+
+// boltOpenTimeout is how long to wait for another process holding the bbolt file
+const boltOpenTimeout = 30 * time.Second
+
+// boltStorage keeps the database in terraform-provider-ansible.db, with a bucket for the Groups and one for the
+// Hosts, stored in the same format as the JSON storage
+type boltStorage struct {
+	dbFile string
+}
+
+// NewBoltStorage returns a Storage which keeps the database in an embedded bbolt store in the given path
+func NewBoltStorage(path string) Storage {
+	return &boltStorage{
+		dbFile: fmt.Sprintf("%s%sterraform-provider-ansible.db", path, string(os.PathSeparator)),
+	}
+}
+
+func (s *boltStorage) Path() string {
+	return s.dbFile
+}
+
+func (s *boltStorage) Exists() bool {
+	_, err := os.Stat(s.dbFile)
+	return err == nil
+}
+
+func (s *boltStorage) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(s.dbFile, 0644, &bolt.Options{Timeout: boltOpenTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database file '%s': %s", s.dbFile, err.Error())
+	}
+	return db, nil
+}
+
+// Read loads the groups and hosts from the store
+func (s *boltStorage) Read() (map[string]Group, error) {
+	if !s.Exists() {
+		return map[string]Group{}, nil
+	}
+
+	db, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var groups map[string]Group
+	err = db.View(func(tx *bolt.Tx) error {
+		if err := checkBoltVersion(tx); err != nil {
+			return err
+		}
+
+		hosts := make(map[string]*Host)
+		if b := tx.Bucket(boltHostsBucket); b != nil {
+			if err := b.ForEach(func(k, v []byte) error {
+				h := &Host{}
+				if err := json.Unmarshal(v, h); err != nil {
+					return fmt.Errorf("invalid host '%s': %s", string(k), err.Error())
+				}
+				hosts[string(k)] = h
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		stored := make(map[string]json.RawMessage)
+		if b := tx.Bucket(boltGroupsBucket); b != nil {
+			if err := b.ForEach(func(k, v []byte) error {
+				stored[string(k)] = append(json.RawMessage{}, v...)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		groups, err = resolveGroups(stored, hosts)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load database file '%s': %s", s.dbFile, err.Error())
+	}
+	return groups, nil
+}
+
+// Write updates the store in a single transaction, where only the groups and hosts which changed are written and
+// those which no longer exist are deleted
+func (s *boltStorage) Write(groups map[string]Group) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := checkBoltVersion(tx); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(boltVersionKey, []byte(strconv.Itoa(currentVersion))); err != nil {
+			return err
+		}
+
+		values := make(map[string]interface{}, len(groups))
+		for k, g := range groups {
+			values[k] = g
+		}
+		if err := syncBucket(tx, boltGroupsBucket, values); err != nil {
+			return err
+		}
+
+		values = make(map[string]interface{})
+		for k, h := range hostsOf(groups) {
+			values[k] = h
+		}
+		return syncBucket(tx, boltHostsBucket, values)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write database file '%s': %s", s.dbFile, err.Error())
+	}
+	return nil
+}
+
+// checkBoltVersion makes sure the store was not written by a newer version of the provider
+func checkBoltVersion(tx *bolt.Tx) error {
+	meta := tx.Bucket(boltMetaBucket)
+	if meta == nil {
+		return nil
+	}
+	version, err := strconv.Atoi(string(meta.Get(boltVersionKey)))
+	if err != nil {
+		return fmt.Errorf("invalid database version '%s'", string(meta.Get(boltVersionKey)))
+	}
+	if version > currentVersion {
+		return unsupportedVersionError{version: version}
+	}
+	return nil
+}
+
+// syncBucket makes the contents of a bucket match the values, encoded as JSON, without rewriting unchanged keys
+func syncBucket(tx *bolt.Tx, name []byte, values map[string]interface{}) error {
+	b, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+
+	var removed [][]byte
+	if err := b.ForEach(func(k, _ []byte) error {
+		if _, ok := values[string(k)]; !ok {
+			removed = append(removed, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range removed {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to serialize '%s': %s", k, err.Error())
+		}
+		if bytes.Equal(b.Get([]byte(k)), data) {
+			continue
+		}
+		if err := b.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"github.com/rs/zerolog/log"
+	"io/ioutil"
+	"os"
+)
+
+// databaseFile is the on-disk layout of the JSON storage, where every Host is stored once and referenced by its ID
+// from all the Groups it is a member of. Files with an older version are upgraded by the migrations when loaded.
+type databaseFile struct {
+	Version int                        `json:"version"`
+	Groups  map[string]json.RawMessage `json:"groups"`
+	Hosts   map[string]*Host           `json:"hosts"`
+}
+
+// jsonStorage keeps the database in terraform-provider-ansible.json, with the previous version kept as a backup
+type jsonStorage struct {
+	dbFile     string
+	backupFile string
+}
+
+// NewJSONStorage returns a Storage which keeps the database in a JSON file in the given path
+func NewJSONStorage(path string) Storage {
+	dbFile := fmt.Sprintf("%s%sterraform-provider-ansible.json", path, string(os.PathSeparator))
+	return &jsonStorage{
+		dbFile:     dbFile,
+		backupFile: fmt.Sprintf("%s.bak", dbFile),
+	}
+}
+
+func (s *jsonStorage) Path() string {
+	return s.dbFile
+}
+
+func (s *jsonStorage) Exists() bool {
+	_, err := os.Stat(s.dbFile)
+	return err == nil
+}
+
+// Write commits the groups to disk. The file is replaced atomically, and the current file is kept as the last good
+// copy before it is replaced.
+func (s *jsonStorage) Write(groups map[string]Group) error {
+	aux := &struct {
+		Version int              `json:"version"`
+		Groups  map[string]Group `json:"groups"`
+		Hosts   map[string]*Host `json:"hosts"`
+	}{
+		Version: currentVersion,
+		Groups:  groups,
+		Hosts:   hostsOf(groups),
+	}
+
+	if current, err := ioutil.ReadFile(s.dbFile); err == nil && len(current) > 0 {
+		if _, _, err := unmarshalJSON(current); err == nil {
+			if err := util.WriteFileAtomic(s.backupFile, current, os.ModePerm); err != nil {
+				return fmt.Errorf("failed to write database backup file '%s': %s", s.backupFile, err.Error())
+			}
+		}
+	}
+
+	if jsonString, err := json.MarshalIndent(aux, "", "\t"); err != nil {
+		return fmt.Errorf("failed to serialize database to '%s': %s", s.dbFile, err.Error())
+	} else {
+		if err := util.WriteFileAtomic(s.dbFile, jsonString, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to write database file '%s': %s", s.dbFile, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Read loads the groups from disk. If the database file cannot be read, the last good copy of the database is loaded
+// instead, with a warning as it rolls back the latest changes. A database file with an older version of the on-disk format is upgraded in memory only, as readers do not
+// always hold the inventory lock, and is written in the current version by the next Write.
+func (s *jsonStorage) Read() (map[string]Group, error) {
+	if _, err := os.Stat(s.dbFile); os.IsNotExist(err) {
+		return map[string]Group{}, nil
+	}
+
+	groups, _, err := s.load(s.dbFile)
+	if err == nil {
+		return groups, nil
+	}
+	if _, ok := err.(unsupportedVersionError); ok {
+		return nil, fmt.Errorf("failed to load database file '%s': %s", s.dbFile, err.Error())
+	}
+
+	if _, berr := os.Stat(s.backupFile); berr != nil {
+		if err == errEmptyDatabase {
+			return map[string]Group{}, nil
+		}
+		return nil, err
+	}
+	groups, _, berr := s.load(s.backupFile)
+	if berr != nil {
+		return nil, err
+	}
+	log.Warn().Err(err).Str("database", s.dbFile).Str("backup", s.backupFile).
+		Msg("failed to load the database, loaded the last good copy from the backup instead")
+	return groups, nil
+}
+
+// errEmptyDatabase is returned when a database file is empty, which Write never produces
+var errEmptyDatabase = errors.New("database file is empty")
+
+// load reads a database file and returns the version of the on-disk format it was written with
+func (s *jsonStorage) load(file string) (map[string]Group, int, error) {
+	jsonString, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load database file '%s': %s", file, err.Error())
+	}
+
+	if len(jsonString) == 0 {
+		return nil, 0, errEmptyDatabase
+	}
+
+	groups, version, err := unmarshalJSON(jsonString)
+	if err != nil {
+		if _, ok := err.(unsupportedVersionError); ok {
+			return nil, version, err
+		}
+		return nil, version, fmt.Errorf("failed to deserialize database '%s' to json: %s", file, err.Error())
+	}
+
+	return groups, version, nil
+}
+
+// unmarshalJSON migrates the contents of a database file to the current version and decodes it, returning the
+// version it was migrated from
+func unmarshalJSON(data []byte) (map[string]Group, int, error) {
+	data, version, err := migrate(data)
+	if err != nil {
+		return nil, version, err
+	}
+
+	aux := &databaseFile{}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return nil, version, err
+	}
+
+	groups, err := resolveGroups(aux.Groups, aux.Hosts)
+	if err != nil {
+		return nil, version, err
+	}
+	return groups, version, nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"testing"
+)
+
+const StorageDbPath = "/tmp/storage"
+
+func TestStorageRoundTrip(t *testing.T) {
+	for _, kind := range Storages {
+		t.Run(kind, func(t *testing.T) {
+			assert.NoError(t, os.MkdirAll(StorageDbPath, os.ModePerm))
+			defer os.RemoveAll(StorageDbPath)
+
+			storage, err := NewStorage(StorageDbPath, kind)
+			assert.NoError(t, err)
+			db := NewDatabaseWithStorage(storage)
+			assert.False(t, db.Exists())
+			assert.NoError(t, db.Load())
+
+			h := NewHost("192.168.0.180", map[string]interface{}{"ansible_port": 22})
+			master := NewGroup("master")
+			master.SetVariables(map[string]interface{}{"k3s_role": "server"})
+			_ = master.AddEntity(h)
+			_ = db.AddGroup(*master)
+			monitoring := NewGroup("monitoring")
+			_ = monitoring.AddEntity(h)
+			_ = db.AddGroup(*monitoring)
+			cluster := NewGroup("k3s_cluster")
+			_ = db.AddGroup(*cluster)
+			assert.NoError(t, db.SetChildren(cluster.GetID(), []string{master.GetID()}))
+			assert.NoError(t, db.Commit())
+			assert.True(t, db.Exists())
+
+			db2, err := Open(StorageDbPath, StorageJSON)
+			assert.NoError(t, err)
+			assert.Equal(t, db.Path(), db2.Path())
+			assert.NoError(t, db2.Load())
+			assert.Equal(t, 3, len(db2.groups))
+			assert.Equal(t, 1, len(db2.hosts()))
+			assert.Equal(t, 2, len(db2.FindGroupsByEntryID(h.GetID())))
+			assert.True(t, db2.Group(cluster.GetID()).HasChild(master.GetID()))
+			assert.Equal(t, "server", db2.Group(master.GetID()).GetVariables()["k3s_role"])
+			assert.Equal(t, float64(22), db2.hosts()[h.GetID()].GetVariables()["ansible_port"])
+
+			// removed groups and hosts are removed from the storage
+			g := db2.Group(monitoring.GetID())
+			assert.NoError(t, db2.RemoveGroup(*g))
+			g = db2.Group(master.GetID())
+			assert.NoError(t, g.RemoveEntity(h))
+			db2.UpdateGroup(*g)
+			assert.NoError(t, db2.Commit())
+
+			db3 := NewDatabaseWithStorage(storage)
+			assert.NoError(t, db3.Load())
+			assert.Equal(t, 2, len(db3.groups))
+			assert.Equal(t, 0, len(db3.hosts()))
+		})
+	}
+}
+
+func TestOpenDetectsStorage(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(StorageDbPath, os.ModePerm))
+	defer os.RemoveAll(StorageDbPath)
+
+	// a new database uses the requested storage
+	db, err := Open(StorageDbPath, StorageBolt)
+	assert.NoError(t, err)
+	assert.Equal(t, NewBoltStorage(StorageDbPath).Path(), db.Path())
+	_ = db.AddGroup(*NewGroup("master"))
+	assert.NoError(t, db.Commit())
+
+	// an existing database keeps the storage it was written with
+	db, err = Open(StorageDbPath, StorageJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, NewBoltStorage(StorageDbPath).Path(), db.Path())
+	assert.NoError(t, db.Load())
+	_, err = db.FindGroupByName("master")
+	assert.NoError(t, err)
+
+	_, err = Open(StorageDbPath+"/unknown", "sqlite")
+	assert.Error(t, err)
+}
+
+func TestBoltNewerVersion(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(StorageDbPath, os.ModePerm))
+	defer os.RemoveAll(StorageDbPath)
+
+	db := NewDatabaseWithStorage(NewBoltStorage(StorageDbPath))
+	_ = db.AddGroup(*NewGroup("master"))
+	assert.NoError(t, db.Commit())
+
+	b, err := bolt.Open(db.Path(), 0644, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, b.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMetaBucket).Put(boltVersionKey, []byte("99"))
+	}))
+	assert.NoError(t, b.Close())
+
+	err = NewDatabaseWithStorage(NewBoltStorage(StorageDbPath)).Load()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "upgrade the provider")
+	assert.Error(t, db.Commit(), "a newer database is never overwritten")
+}
@@ -3,64 +3,262 @@ package ansible
 import (
 	"fmt"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
-	"io/ioutil"
-	"log"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/vault"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"math"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// EncoderOptions controls how the database is encoded to an inventory
+type EncoderOptions struct {
+	// HostVarsFiles leaves the host variables out of the inventory, as they are exported to host_vars/<host>.yml
+	HostVarsFiles bool
+	// OmitEncrypted leaves vault encrypted host variables out of the inventory, as INI cannot hold them
+	OmitEncrypted bool
+}
+
 // Encode function encodes the database to an Ansible compatible hosts.ini file
 func Encode(file string, database *database.Database) error {
+	data, err := encodeINI(database, EncoderOptions{})
+	if err != nil {
+		return err
+	}
+
+	if err := util.WriteFileAtomic(file, data, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to save file '%s'", file)
+	}
+	return nil
+}
+
+func encodeINI(database *database.Database, opts EncoderOptions) ([]byte, error) {
 	var s string
-	for _, v := range *database.AllGroups() {
+	for _, v := range database.SortedGroups() {
 		ek := v.GetEntities()
 		if len(ek) == 0 {
-			s = s + fmt.Sprintf("[%s]\n", v.GetName())
+			// a group with children is declared by its children section
+			if len(v.GetChildren()) == 0 {
+				s = s + fmt.Sprintf("[%s]\n\n", v.GetName())
+			}
 		} else {
 			s = s + fmt.Sprintf("[%s]\n", v.GetName())
 			for _, k := range ek {
 				e, err := v.GetEntity(k)
 				if err != nil {
-					log.Fatalf("failed to lookup entity '%s'", k)
+					return nil, fmt.Errorf("failed to lookup entity '%s'", k)
 				}
 
-				es, err := encodeEntity(e)
+				es, err := encodeEntity(e, opts)
 				if err != nil {
-					log.Fatalf("failed to encode entity %s", err.Error())
+					return nil, fmt.Errorf("failed to encode entity: %s", err.Error())
 				}
 				s = s + fmt.Sprintf("%s\n", es)
 			}
 			s = s + "\n"
 		}
+
+		if len(v.GetChildren()) > 0 {
+			gs, err := encodeGroup(database, &v)
+			if err != nil {
+				return nil, err
+			}
+			s = s + gs + "\n"
+		}
+
+		if len(v.GetVariableNames()) > 0 {
+			gs, err := encodeGroupVars(&v)
+			if err != nil {
+				return nil, err
+			}
+			s = s + gs + "\n"
+		}
 	}
-	if err := ioutil.WriteFile(file, []byte(s), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to save file '%s'", file)
-	}
-	return nil
+	return []byte(s), nil
 }
 
-func encodeEntity(e interface{}) (string, error) {
+func encodeEntity(e interface{}, opts EncoderOptions) (string, error) {
 	switch t := e.(type) {
 	case *database.Host:
-		return encodeHost(e.(*database.Host)), nil
+		if opts.HostVarsFiles {
+			return e.(*database.Host).GetName(), nil
+		}
+		return encodeHost(e.(*database.Host), opts)
 	case *database.Group:
-		return encodeGroup(e.(*database.Group)), nil
+		return e.(*database.Group).GetName(), nil
 	default:
 		return "", fmt.Errorf("unknown entity type %s", t)
 	}
 }
 
-func encodeGroup(g *database.Group) string {
-	return g.GetName()
+func encodeGroup(db *database.Database, g *database.Group) (string, error) {
+	var names []string
+	for _, id := range g.GetChildren() {
+		c := db.Group(id)
+		if c == nil {
+			return "", fmt.Errorf("unable to find expected child group '%s'", id)
+		}
+		names = append(names, c.GetName())
+	}
+	sort.Strings(names)
+
+	s := fmt.Sprintf("[%s:children]\n", g.GetName())
+	for _, n := range names {
+		s = s + fmt.Sprintf("%s\n", n)
+	}
+	return s, nil
+}
+
+// encodeGroupVars writes a [name:vars] section. Ansible splits these lines on the first '=' and evaluates the rest
+// of the line as a Python literal, so no shell quoting is needed.
+func encodeGroupVars(g *database.Group) (string, error) {
+	s := fmt.Sprintf("[%s:vars]\n", g.GetName())
+	for _, vk := range g.GetVariableNames() {
+		v, err := g.GetVariable(vk)
+		if err != nil {
+			return "", fmt.Errorf("unable to find expected group variable '%s'", vk)
+		}
+		ev, err := encodeValue(v)
+		if err != nil {
+			return "", fmt.Errorf("unable to encode variable '%s' of group '%s': %s", vk, g.GetName(), err.Error())
+		}
+		s = s + fmt.Sprintf("%s=%s\n", vk, ev)
+	}
+	return s, nil
 }
 
-func encodeHost(h *database.Host) string {
+// encodeHost writes a host line. Ansible splits host lines like a shell would before evaluating each value as a
+// Python literal, so values which would be split or unquoted by the shell rules are quoted on top of the literal.
+func encodeHost(h *database.Host, opts EncoderOptions) (string, error) {
 	s := h.GetName()
 	for _, vk := range h.GetVariableNames() {
 		v, err := h.GetVariable(vk)
 		if err != nil {
-			log.Fatalf("unalbe to find expected host variable '%s'", vk)
+			return "", fmt.Errorf("unable to find expected host variable '%s'", vk)
+		}
+		if _, ok := vault.FromValue(v); ok && opts.OmitEncrypted {
+			continue
+		}
+		ev, err := encodeValue(v)
+		if err != nil {
+			return "", fmt.Errorf("unable to encode variable '%s' of host '%s': %s", vk, h.GetName(), err.Error())
+		}
+		if strings.ContainsAny(ev, " \t'\"\\#") {
+			ev = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(ev) + `"`
+		}
+		s = s + fmt.Sprintf(" %s=%s", vk, ev)
+	}
+	return s, nil
+}
+
+// bareValue matches strings which can be written to an INI inventory without any quoting
+var bareValue = regexp.MustCompile(`^[A-Za-z0-9_./:@-]+$`)
+
+// isBareValue checks if a string can be written to an INI inventory without quotes. Strings such as "22" or "True"
+// are written bare as well, as earlier versions did, so Ansible keeps reading them as numbers and booleans and
+// existing inventories do not change type. Typed values are set with variables_json.
+func isBareValue(s string) bool {
+	return bareValue.MatchString(s)
+}
+
+// encodeValue formats a variable value the way Ansible evaluates values in an INI inventory. Plain words are written
+// as is, everything else is written as a Python literal which Ansible evaluates back to the same value.
+func encodeValue(v interface{}) (string, error) {
+	if t, ok := v.(string); ok && isBareValue(t) {
+		return t, nil
+	}
+	return encodePythonLiteral(v)
+}
+
+func encodePythonLiteral(v interface{}) (string, error) {
+	if _, ok := vault.FromValue(v); ok {
+		return "", fmt.Errorf("vault encrypted values cannot be written to an INI inventory, use the yaml or json format or host_vars_files")
+	}
+	switch t := v.(type) {
+	case string:
+		return encodePythonString(t)
+	case bool:
+		if t {
+			return "True", nil
+		}
+		return "False", nil
+	case nil:
+		return "None", nil
+	case float64:
+		if math.IsInf(t, 0) || math.IsNaN(t) {
+			return "", fmt.Errorf("%v cannot be written as a Python literal", t)
+		}
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case int, int32, int64:
+		return fmt.Sprint(t), nil
+	case []interface{}:
+		items := make([]string, 0, len(t))
+		for _, i := range t {
+			ei, err := encodePythonLiteral(i)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, ei)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, 0, len(t))
+		for _, k := range keys {
+			ek, err := encodePythonString(k)
+			if err != nil {
+				return "", err
+			}
+			ev, err := encodePythonLiteral(t[k])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, ek+": "+ev)
+		}
+		return "{" + strings.Join(items, ", ") + "}", nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", t)
+	}
+}
+
+// encodePythonString writes a single quoted Python string literal, escaping everything which would end the literal
+// or the line it is written on
+func encodePythonString(s string) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("value is not valid UTF-8")
+	}
+
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+				b.WriteString(fmt.Sprintf(`\U%08x`, r))
+			} else {
+				b.WriteRune(r)
+			}
 		}
-		s = s + fmt.Sprintf(" %s=%s", vk, v)
 	}
-	return s
+	b.WriteByte('\'')
+	return b.String(), nil
 }
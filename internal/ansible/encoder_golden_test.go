@@ -0,0 +1,89 @@
+package ansible
+
+import (
+	"flag"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenDatabase returns a database where groups, hosts and variables are added out of order
+func goldenDatabase() *database.Database {
+	db := database.NewDatabase(DbPath)
+
+	workers := database.NewGroup("workers")
+	workers.SetVariables(map[string]interface{}{"zone": "b", "k3s_role": "agent"})
+	for _, h := range []string{"node-3", "node-1", "node-2"} {
+		_ = workers.AddEntity(database.NewHost(h, map[string]interface{}{"ansible_user": "ubuntu", "ansible_port": float64(22)}))
+	}
+	_ = db.AddGroup(*workers)
+
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("master-1", map[string]interface{}{"name": "master-1", "enabled": true, "ansible_host": "192.168.0.180"}))
+	_ = db.AddGroup(*master)
+
+	empty := database.NewGroup("empty")
+	_ = db.AddGroup(*empty)
+
+	cluster := database.NewGroup("cluster")
+	_ = db.AddGroup(*cluster)
+	_ = db.SetChildren(cluster.GetID(), []string{workers.GetID(), master.GetID()})
+
+	return db
+}
+
+func assertGolden(t *testing.T, file string, render func(*database.Database, EncoderOptions) ([]byte, error)) {
+	db := goldenDatabase()
+	data, err := render(db, EncoderOptions{})
+	assert.NoError(t, err)
+
+	golden := filepath.Join("testdata", file)
+	if *update {
+		assert.NoError(t, ioutil.WriteFile(golden, data, 0644))
+	}
+	expected, err := ioutil.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(data))
+
+	// map iteration order is random, so render a few more times to make sure the output does not change
+	for i := 0; i < 10; i++ {
+		again, err := render(db, EncoderOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), string(again))
+	}
+}
+
+func TestGoldenINI(t *testing.T) {
+	assertGolden(t, "inventory.ini", encodeINI)
+}
+
+func TestGoldenYAML(t *testing.T) {
+	assertGolden(t, "inventory.yml", encodeYAML)
+}
+
+func TestGoldenJSON(t *testing.T) {
+	assertGolden(t, "inventory.json", encodeJSON)
+}
+
+func TestINIRoundTrip(t *testing.T) {
+	db := goldenDatabase()
+	h, _ := db.FindHostByName("master-1")
+	h.SetVariable("motd", "welcome # to \"master\"\nsee 'docs'")
+	h.SetVariable("ports", []interface{}{float64(80), map[string]interface{}{"tls": true}})
+
+	data, err := encodeINI(db, EncoderOptions{})
+	assert.NoError(t, err)
+
+	decoded := database.NewDatabase(DbPath)
+	_, err = inventory.DecodeINI(data, decoded)
+	assert.NoError(t, err)
+
+	again, err := encodeINI(decoded, EncoderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), string(again))
+}
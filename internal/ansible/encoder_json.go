@@ -0,0 +1,123 @@
+package ansible
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"sort"
+)
+
+// jsonGroup is a group in the format produced by `ansible-inventory --list`
+type jsonGroup struct {
+	Hosts    []string               `json:"hosts,omitempty"`
+	Children []string               `json:"children,omitempty"`
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+}
+
+// jsonMeta holds the variables of every host in the inventory
+type jsonMeta struct {
+	HostVars map[string]map[string]interface{} `json:"hostvars"`
+}
+
+// RenderJSON renders the database as dynamic inventory JSON, as expected from an inventory script called with --list
+func RenderJSON(database *database.Database) ([]byte, error) {
+	return encodeJSON(database, EncoderOptions{})
+}
+
+// RenderHostJSON renders the variables of a single host, as expected from an inventory script called with --host
+func RenderHostJSON(db *database.Database, name string) ([]byte, error) {
+	vars := make(map[string]interface{})
+	for _, v := range db.SortedGroups() {
+		e, err := v.FindEntityByName(name)
+		if err != nil {
+			continue
+		}
+		if h, ok := e.(*database.Host); ok && h.GetVariables() != nil {
+			vars = h.GetVariables()
+			break
+		}
+	}
+
+	data, err := json.MarshalIndent(vars, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host '%s': %s", name, err.Error())
+	}
+	return data, nil
+}
+
+// encodeJSON always includes the host variables in _meta.hostvars, as dynamic inventory consumers do not read
+// host_vars files
+func encodeJSON(db *database.Database, _ EncoderOptions) ([]byte, error) {
+	meta := jsonMeta{HostVars: make(map[string]map[string]interface{})}
+	groups := make(map[string]*jsonGroup)
+	isChild := make(map[string]bool)
+
+	for _, v := range db.SortedGroups() {
+		name := v.GetName()
+		g, ok := groups[name]
+		if !ok {
+			g = &jsonGroup{}
+			groups[name] = g
+		}
+		if len(v.GetVariableNames()) > 0 {
+			g.Vars = v.GetVariables()
+		}
+		for _, id := range v.GetChildren() {
+			c := db.Group(id)
+			if c == nil {
+				return nil, fmt.Errorf("failed to lookup child group '%s'", id)
+			}
+			g.Children = append(g.Children, c.GetName())
+			isChild[c.GetName()] = true
+		}
+
+		for _, k := range v.GetEntities() {
+			e, err := v.GetEntity(k)
+			if err != nil {
+				return nil, fmt.Errorf("failed to lookup entity '%s'", k)
+			}
+
+			switch t := e.(type) {
+			case *database.Host:
+				g.Hosts = append(g.Hosts, t.GetName())
+				vars := t.GetVariables()
+				if vars == nil {
+					vars = make(map[string]interface{})
+				}
+				meta.HostVars[t.GetName()] = vars
+			case *database.Group:
+				g.Children = append(g.Children, t.GetName())
+				isChild[t.GetName()] = true
+			default:
+				return nil, fmt.Errorf("unknown entity type %s", t)
+			}
+		}
+		sort.Strings(g.Hosts)
+		sort.Strings(g.Children)
+	}
+
+	all := &jsonGroup{}
+	for name := range groups {
+		if !isChild[name] && name != "ungrouped" {
+			all.Children = append(all.Children, name)
+		}
+	}
+	sort.Strings(all.Children)
+	// ungrouped is only listed when it has hosts, and then always comes last like in `ansible-inventory --list`
+	if g, ok := groups["ungrouped"]; ok && len(g.Hosts) > 0 {
+		all.Children = append(all.Children, "ungrouped")
+	}
+
+	out := make(map[string]interface{})
+	for name, g := range groups {
+		out[name] = g
+	}
+	out["all"] = all
+	out["_meta"] = meta
+
+	data, err := json.MarshalIndent(out, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode json inventory: %s", err.Error())
+	}
+	return data, nil
+}
@@ -0,0 +1,72 @@
+package ansible
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExportJSON(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+
+	// add some test data
+	masterVariables := make(map[string]interface{})
+	masterVariables["name"] = "master-1"
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("192.168.0.180", masterVariables))
+	_ = db.AddGroup(*master)
+
+	node := database.NewGroup("node")
+	_ = node.AddEntity(database.NewHost("192.168.0.182", nil))
+	_ = node.AddEntity(database.NewHost("192.168.0.181", nil))
+	_ = db.AddGroup(*node)
+
+	groupInGroup := database.NewGroup("k3s_cluster")
+	_ = db.AddGroup(*groupInGroup)
+	_ = db.SetChildren(groupInGroup.GetID(), []string{master.GetID(), node.GetID()})
+
+	// run test
+	data, err := encodeJSON(db, EncoderOptions{})
+	if err != nil {
+		assert.Fail(t, fmt.Sprintf("failed to encode inventory: %s", err.Error()))
+	}
+	fmt.Print(string(data))
+
+	var inv map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &inv))
+
+	assert.Equal(t, []interface{}{"k3s_cluster"}, inv["all"]["children"])
+	assert.Equal(t, []interface{}{"master", "node"}, inv["k3s_cluster"]["children"])
+	assert.Equal(t, []interface{}{"192.168.0.180"}, inv["master"]["hosts"])
+	assert.Equal(t, []interface{}{"192.168.0.181", "192.168.0.182"}, inv["node"]["hosts"])
+
+	hostVars := inv["_meta"]["hostvars"].(map[string]interface{})
+	assert.Equal(t, 3, len(hostVars))
+	assert.Equal(t, "master-1", hostVars["192.168.0.180"].(map[string]interface{})["name"])
+}
+
+func TestExportJSONUngrouped(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+	ungrouped := database.NewGroup("ungrouped")
+	_ = db.AddGroup(*ungrouped)
+	_ = db.AddGroup(*database.NewGroup("master"))
+
+	// an empty ungrouped group is not listed
+	data, err := encodeJSON(db, EncoderOptions{})
+	assert.NoError(t, err)
+	var inv map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &inv))
+	assert.Equal(t, []interface{}{"master"}, inv["all"]["children"])
+
+	// ungrouped hosts are listed last
+	_ = ungrouped.AddEntity(database.NewHost("192.168.0.183", nil))
+	db.UpdateGroup(*ungrouped)
+	data, err = encodeJSON(db, EncoderOptions{})
+	assert.NoError(t, err)
+	inv = nil
+	assert.NoError(t, json.Unmarshal(data, &inv))
+	assert.Equal(t, []interface{}{"master", "ungrouped"}, inv["all"]["children"])
+	assert.Equal(t, []interface{}{"192.168.0.183"}, inv["ungrouped"]["hosts"])
+}
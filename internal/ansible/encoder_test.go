@@ -11,7 +11,11 @@ import (
 const DbPath = "/tmp"
 const EncodeFile = "/tmp/encode_test.ini"
 
-const TestHostData = `[master]
+const TestHostData = `[k3s_cluster:children]
+master
+node
+
+[master]
 192.168.0.180 name=master-1
 
 [node]
@@ -21,10 +25,6 @@ const TestHostData = `[master]
 192.168.0.184
 192.168.0.185
 
-[k3s_cluster:children]
-master
-node
-
 `
 
 func TestExport(t *testing.T) {
@@ -45,10 +45,9 @@ func TestExport(t *testing.T) {
 	_ = node.AddEntity(database.NewHost("192.168.0.185", nil))
 	_ = db.AddGroup(*node)
 
-	groupInGroup := database.NewGroup("k3s_cluster:children")
-	_ = groupInGroup.AddEntity(database.NewGroup(master.GetName()))
-	_ = groupInGroup.AddEntity(database.NewGroup(node.GetName()))
+	groupInGroup := database.NewGroup("k3s_cluster")
 	_ = db.AddGroup(*groupInGroup)
+	_ = db.SetChildren(groupInGroup.GetID(), []string{master.GetID(), node.GetID()})
 
 	// run test
 	if err := Encode(EncodeFile, db); err != nil {
@@ -59,6 +58,110 @@ func TestExport(t *testing.T) {
 		assert.Fail(t, fmt.Sprintf("failed read encoded file: %s", err.Error()))
 	} else {
 		fmt.Print(string(data))
-		assert.Equal(t, len(TestHostData), len(string(data)))
+		assert.Equal(t, TestHostData, string(data))
 	}
 }
+
+func TestExportGroupVars(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+
+	master := database.NewGroup("master")
+	master.SetVariables(map[string]interface{}{"k3s_role": "server"})
+	_ = master.AddEntity(database.NewHost("192.168.0.180", nil))
+	_ = db.AddGroup(*master)
+
+	if err := Encode(EncodeFile, db); err != nil {
+		assert.Fail(t, fmt.Sprintf("failed to encode file: %s", err.Error()))
+	}
+
+	if data, err := ioutil.ReadFile(EncodeFile); err != nil {
+		assert.Fail(t, fmt.Sprintf("failed read encoded file: %s", err.Error()))
+	} else {
+		assert.Equal(t, "[master]\n192.168.0.180\n\n[master:vars]\nk3s_role=server\n\n", string(data))
+	}
+}
+
+func TestExportTypedVariables(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+
+	variables := make(map[string]interface{})
+	variables["ansible_port"] = float64(22)
+	variables["enabled"] = true
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("192.168.0.180", variables))
+	_ = db.AddGroup(*master)
+
+	data, err := encodeINI(db, EncoderOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ansible_port=22")
+	assert.Contains(t, string(data), "enabled=True")
+}
+
+func TestEncodeValue(t *testing.T) {
+	cases := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"master-1", "master-1"},
+		{"192.168.0.180", "192.168.0.180"},
+		{"with space", "'with space'"},
+		{"a=b", "'a=b'"},
+		{"not # a comment", "'not # a comment'"},
+		{`it's "quoted"`, `'it\'s "quoted"'`},
+		{"line\nbreak", `'line\nbreak'`},
+		{`back\slash`, `'back\\slash'`},
+		{"22", "22"},
+		{"1.5", "1.5"},
+		{"True", "True"},
+		{"", "''"},
+		{float64(22), "22"},
+		{true, "True"},
+		{nil, "None"},
+		{[]interface{}{"a b", float64(1), false}, "['a b', 1, False]"},
+		{map[string]interface{}{"b": nil, "a": "x"}, "{'a': 'x', 'b': None}"},
+	}
+	for _, c := range cases {
+		v, err := encodeValue(c.value)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, v)
+	}
+
+	_, err := encodeValue("\xff")
+	assert.Error(t, err)
+}
+
+func TestExportQuotedVariables(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+
+	master := database.NewGroup("master")
+	master.SetVariables(map[string]interface{}{"motd": "welcome # to \"master\""})
+	_ = master.AddEntity(database.NewHost("192.168.0.180", map[string]interface{}{
+		"description": "first node, don't touch",
+		"ports":       []interface{}{float64(80), float64(443)},
+	}))
+	_ = db.AddGroup(*master)
+
+	data, err := encodeINI(db, EncoderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `[master]
+192.168.0.180 description="'first node, don\\'t touch'" ports="[80, 443]"
+
+[master:vars]
+motd='welcome # to "master"'
+
+`, string(data))
+}
+
+func TestExportLegacyStringVariables(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+
+	// earlier versions wrote every value as is, so Ansible read numbers and booleans from strings, which must not
+	// change for existing inventories
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("k3s-master-1", map[string]interface{}{"ansible_port": "22", "enabled": "True"}))
+	_ = db.AddGroup(*master)
+
+	data, err := encodeINI(db, EncoderOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "[master]\nk3s-master-1 ansible_port=22 enabled=True\n\n", string(data))
+}
@@ -0,0 +1,102 @@
+package ansible
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlGroup is a group in the layout read by the Ansible yaml inventory plugin
+type yamlGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts,omitempty"`
+	Vars     map[string]interface{}            `yaml:"vars,omitempty"`
+	Children map[string]*yamlGroup             `yaml:"children,omitempty"`
+}
+
+func encodeYAML(db *database.Database, opts EncoderOptions) ([]byte, error) {
+	all := &yamlGroup{Children: make(map[string]*yamlGroup)}
+	for _, v := range db.SortedGroups() {
+		g := all.child(v.GetName())
+		if len(v.GetVariableNames()) > 0 {
+			g.Vars = yamlVariables(v.GetVariables())
+		}
+		for _, id := range v.GetChildren() {
+			c := db.Group(id)
+			if c == nil {
+				return nil, fmt.Errorf("failed to lookup child group '%s'", id)
+			}
+			g.child(c.GetName())
+		}
+		for _, k := range v.GetEntities() {
+			e, err := v.GetEntity(k)
+			if err != nil {
+				return nil, fmt.Errorf("failed to lookup entity '%s'", k)
+			}
+
+			switch t := e.(type) {
+			case *database.Host:
+				if g.Hosts == nil {
+					g.Hosts = make(map[string]map[string]interface{})
+				}
+				if opts.HostVarsFiles {
+					g.Hosts[t.GetName()] = nil
+				} else {
+					g.Hosts[t.GetName()] = yamlVariables(t.GetVariables())
+				}
+			case *database.Group:
+				g.child(t.GetName())
+			default:
+				return nil, fmt.Errorf("unknown entity type %s", t)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]*yamlGroup{"all": all}); err != nil {
+		return nil, fmt.Errorf("failed to encode yaml inventory: %s", err.Error())
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode yaml inventory: %s", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlVariables replaces encrypted values with !vault tagged strings, which Ansible decrypts when it reads the
+// inventory
+func yamlVariables(variables map[string]interface{}) map[string]interface{} {
+	encrypted := false
+	for _, v := range variables {
+		if _, ok := vault.FromValue(v); ok {
+			encrypted = true
+		}
+	}
+	if !encrypted {
+		return variables
+	}
+
+	result := make(map[string]interface{}, len(variables))
+	for k, v := range variables {
+		if vaulttext, ok := vault.FromValue(v); ok {
+			v = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!vault", Value: vaulttext, Style: yaml.LiteralStyle}
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// child returns the named child group, creating it if it does not exist
+func (s *yamlGroup) child(name string) *yamlGroup {
+	if s.Children == nil {
+		s.Children = make(map[string]*yamlGroup)
+	}
+	if g, ok := s.Children[name]; ok {
+		return g
+	}
+	g := &yamlGroup{}
+	s.Children[name] = g
+	return g
+}
@@ -0,0 +1,52 @@
+package ansible
+
+import (
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestExportYAML(t *testing.T) {
+	db := database.NewDatabase(DbPath)
+
+	// add some test data
+	masterVariables := make(map[string]interface{})
+	masterVariables["name"] = "master-1"
+	masterVariables["enabled"] = true
+	masterVariables["ports"] = []interface{}{80, 443}
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("192.168.0.180", masterVariables))
+	_ = db.AddGroup(*master)
+
+	node := database.NewGroup("node")
+	_ = node.AddEntity(database.NewHost("192.168.0.181", nil))
+	_ = node.AddEntity(database.NewHost("192.168.0.182", nil))
+	_ = db.AddGroup(*node)
+
+	groupInGroup := database.NewGroup("k3s_cluster")
+	_ = db.AddGroup(*groupInGroup)
+	_ = db.SetChildren(groupInGroup.GetID(), []string{master.GetID(), node.GetID()})
+
+	// run test
+	data, err := encodeYAML(db, EncoderOptions{})
+	if err != nil {
+		assert.Fail(t, fmt.Sprintf("failed to encode inventory: %s", err.Error()))
+	}
+	fmt.Print(string(data))
+
+	var inv map[string]map[string]map[string]map[string]map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(data, &inv))
+
+	groups := inv["all"]["children"]
+	assert.Equal(t, 3, len(groups))
+
+	vars := groups["master"]["hosts"]["192.168.0.180"].(map[string]interface{})
+	assert.Equal(t, "master-1", vars["name"])
+	assert.Equal(t, true, vars["enabled"])
+	assert.Equal(t, []interface{}{80, 443}, vars["ports"])
+	assert.Equal(t, 2, len(groups["node"]["hosts"]))
+	assert.Contains(t, groups["k3s_cluster"]["children"], "master")
+	assert.Contains(t, groups["k3s_cluster"]["children"], "node")
+}
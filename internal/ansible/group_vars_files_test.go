@@ -0,0 +1,94 @@
+package ansible
+
+import (
+	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+)
+
+const GroupVarsFilesPath = "/tmp/group_vars_files"
+
+func TestInventoryGroupVarsFiles(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(GroupVarsFilesPath, os.ModePerm))
+	defer os.RemoveAll(GroupVarsFilesPath)
+
+	conf := providerConfiguration{Path: GroupVarsFilesPath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+	r := ansibleInventoryResourceQuery()
+	d := r.TestResourceData()
+	_ = d.Set("group_vars_json", `{"ansible_user":"ubuntu","k3s_ports":[6443,10250]}`)
+	_ = d.Set("group_vars_files", map[string]interface{}{"all/main.yml": "---\nk3s_version: v1.19.5+k3s1\n"})
+	assert.False(t, ansibleInventoryResourceQueryCreate(context.Background(), d, conf).HasError())
+
+	// structured group vars are encoded to YAML, and read back as the same JSON object
+	data, err := os.ReadFile(GroupVarsFilesPath + "/group_vars/all/all.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "---\nansible_user: ubuntu\nk3s_ports:\n    - 6443\n    - 10250\n", string(data))
+	assert.Equal(t, `{"ansible_user":"ubuntu","k3s_ports":[6443,10250]}`, d.Get("group_vars_json"))
+	assert.Equal(t, "", d.Get("group_vars"))
+	assert.FileExists(t, GroupVarsFilesPath+"/group_vars/all/main.yml")
+
+	// files which are not declared show up in group_vars_files, and are removed when the inventory is written again
+	assert.NoError(t, os.WriteFile(GroupVarsFilesPath+"/group_vars/all/stray.yml", []byte("---\n"), os.ModePerm))
+	assert.False(t, ansibleInventoryResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Equal(t, map[string]interface{}{
+		"all/main.yml":  "---\nk3s_version: v1.19.5+k3s1\n",
+		"all/stray.yml": "---\n",
+	}, d.Get("group_vars_files"))
+
+	_ = d.Set("group_vars_files", map[string]interface{}{"all/vault.yml": "---\n"})
+	i, err := inventory.Load(GroupVarsFilesPath, d.Id())
+	assert.NoError(t, err)
+	files, err := groupVarsFiles(conf, d, i)
+	assert.NoError(t, err)
+	assert.NoError(t, i.CommitGroupVarsFiles(files))
+	assert.False(t, ansibleInventoryResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Equal(t, map[string]interface{}{"all/vault.yml": "---\n"}, d.Get("group_vars_files"))
+	assert.NoFileExists(t, GroupVarsFilesPath+"/group_vars/all/main.yml")
+	assert.NoFileExists(t, GroupVarsFilesPath+"/group_vars/all/stray.yml")
+	assert.FileExists(t, GroupVarsFilesPath+"/group_vars/all/all.yml")
+
+	assert.False(t, ansibleInventoryResourceQueryDelete(context.Background(), d, conf).HasError())
+}
+
+func TestValidateGroupVarsFiles(t *testing.T) {
+	path := cty.GetAttrPath("group_vars_files")
+
+	assert.False(t, validateGroupVarsFiles(map[string]interface{}{"all/main.yml": "", "all/vault.yml": ""}, path).HasError())
+	for _, k := range []string{"main.yml", "all/../hosts.ini", "all/nested/main.yml", "master/main.yml", "all/all.yml", "all/sensitive.yml"} {
+		assert.True(t, validateGroupVarsFiles(map[string]interface{}{k: ""}, path).HasError(), k)
+	}
+}
+
+func TestStrictGroupVars(t *testing.T) {
+	conf := providerConfiguration{Path: GroupVarsFilesPath, Mutex: &sync.Mutex{}}
+	r := ansibleInventoryResourceQuery()
+	diff := func(raw map[string]interface{}) error {
+		_, err := r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), conf)
+		return err
+	}
+
+	lenient := map[string]interface{}{"group_vars": "---\ngroups: []\n"}
+	assert.NoError(t, diff(lenient))
+
+	strict := map[string]interface{}{
+		"strict_group_vars": true,
+		"group_vars":        "---\nansible_user: ubuntu\n",
+		"group_vars_files": map[string]interface{}{
+			"all/main.yml":  "---\n- not a mapping\n",
+			"all/vault.yml": "$ANSIBLE_VAULT;1.1;AES256\n6162\n",
+		},
+		"sensitive_group_vars": map[string]interface{}{"inventory_hostname": "master"},
+	}
+	err := diff(strict)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `group_vars_files["all/main.yml"]: line 2, column 1: group vars must be a mapping`)
+	assert.Contains(t, err.Error(), "sensitive_group_vars: 'inventory_hostname' is an Ansible magic variable")
+	assert.NotContains(t, err.Error(), "all/vault.yml")
+
+	assert.NoError(t, diff(map[string]interface{}{"strict_group_vars": true, "group_vars_json": `{"ansible_user":"ubuntu"}`}))
+}
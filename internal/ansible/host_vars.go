@@ -0,0 +1,126 @@
+package ansible
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hostVarsManifest lists the host_vars files written by the provider, so files which are no longer needed can be
+// removed without touching host_vars files managed by someone else
+const hostVarsManifest = ".terraform-provider-ansible"
+
+// GetHostVarsPath returns the path to the host_vars folder of the inventory
+func GetHostVarsPath(path string) string {
+	return fmt.Sprintf("%s%shost_vars", path, string(os.PathSeparator))
+}
+
+// writeHostVars writes the rendered host_vars files, keyed by file name, to host_vars/<host>.yml. Files written by an
+// earlier export which are not among them are removed, so no files are left when host_vars_files is turned off.
+func writeHostVars(path string, files map[string][]byte) error {
+	dir := GetHostVarsPath(path)
+	owned, err := readHostVarsManifest(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range owned {
+		if _, ok := files[f]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale host_vars file '%s': %s", f, err.Error())
+		}
+	}
+
+	if len(files) == 0 {
+		if len(owned) == 0 {
+			return nil
+		}
+		if err := os.Remove(filepath.Join(dir, hostVarsManifest)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove host_vars manifest: %s", err.Error())
+		}
+		// only remove the folder if nobody else has placed files there
+		_ = os.Remove(dir)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create host_vars path: %s", err.Error())
+	}
+	names := make([]string, 0, len(files))
+	for f, data := range files {
+		if err := util.WriteFileAtomic(filepath.Join(dir, f), data, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to save file '%s'", f)
+		}
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	if err := util.WriteFileAtomic(filepath.Join(dir, hostVarsManifest), []byte(strings.Join(names, "\n")+"\n"), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to save host_vars manifest: %s", err.Error())
+	}
+	return nil
+}
+
+// renderHostVars renders the host_vars file of every host with variables, keyed by file name
+func renderHostVars(db *database.Database, enabled bool) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if !enabled {
+		return files, nil
+	}
+	for _, v := range db.SortedGroups() {
+		for _, h := range v.GetHosts() {
+			if len(h.GetVariableNames()) == 0 {
+				continue
+			}
+			if strings.ContainsAny(h.GetName(), `/\`) {
+				return nil, fmt.Errorf("host name '%s' cannot be used as a host_vars file name", h.GetName())
+			}
+
+			data, err := encodeHostVars(h)
+			if err != nil {
+				return nil, err
+			}
+			files[fmt.Sprintf("%s.yml", h.GetName())] = data
+		}
+	}
+	return files, nil
+}
+
+func readHostVarsManifest(dir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, hostVarsManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host_vars manifest: %s", err.Error())
+	}
+
+	var files []string
+	for _, f := range strings.Split(string(data), "\n") {
+		if f = strings.TrimSpace(f); len(f) > 0 {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func encodeHostVars(h *database.Host) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlVariables(h.GetVariables())); err != nil {
+		return nil, fmt.Errorf("failed to encode variables for host '%s': %s", h.GetName(), err.Error())
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode variables for host '%s': %s", h.GetName(), err.Error())
+	}
+	return buf.Bytes(), nil
+}
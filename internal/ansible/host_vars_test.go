@@ -0,0 +1,62 @@
+package ansible
+
+import (
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const HostVarsPath = "/tmp/host_vars_test"
+
+func TestExportHostVars(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(HostVarsPath, os.ModePerm))
+	defer os.RemoveAll(HostVarsPath)
+
+	db := database.NewDatabase(HostVarsPath)
+	master := database.NewGroup("master")
+	h1 := database.NewHost("k3s-master-1", map[string]interface{}{"certificate": "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"})
+	h2 := database.NewHost("k3s-master-2", map[string]interface{}{"role": "master"})
+	_ = master.AddEntity(h1)
+	_ = master.AddEntity(h2)
+	_ = master.AddEntity(database.NewHost("k3s-master-3", nil))
+	_ = db.AddGroup(*master)
+
+	// a host_vars file not written by the provider must be left alone
+	dir := GetHostVarsPath(HostVarsPath)
+	assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "manual.yml"), []byte("---\n"), os.ModePerm))
+
+	conf := providerConfiguration{Formats: []string{"ini"}, HostVarsFiles: true}
+	assert.NoError(t, commitAndExport(db, HostVarsPath, conf))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "k3s-master-1.yml"))
+	assert.NoError(t, err)
+	var vars map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(data, &vars))
+	assert.Equal(t, h1.GetVariables()["certificate"], vars["certificate"])
+	assert.FileExists(t, filepath.Join(dir, "k3s-master-2.yml"))
+	assert.NoFileExists(t, filepath.Join(dir, "k3s-master-3.yml"))
+
+	// the inventory only contains the host names
+	ini, err := ioutil.ReadFile(filepath.Join(HostVarsPath, "hosts.ini"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(ini), "role=master")
+
+	// files of removed hosts are removed on the next export
+	_ = master.RemoveEntity(h2)
+	db.UpdateGroup(*master)
+	assert.NoError(t, commitAndExport(db, HostVarsPath, conf))
+	assert.FileExists(t, filepath.Join(dir, "k3s-master-1.yml"))
+	assert.NoFileExists(t, filepath.Join(dir, "k3s-master-2.yml"))
+
+	// disabling the export removes all files owned by the provider
+	conf.HostVarsFiles = false
+	assert.NoError(t, commitAndExport(db, HostVarsPath, conf))
+	assert.NoFileExists(t, filepath.Join(dir, "k3s-master-1.yml"))
+	assert.NoFileExists(t, filepath.Join(dir, hostVarsManifest))
+	assert.FileExists(t, filepath.Join(dir, "manual.yml"))
+}
@@ -0,0 +1,138 @@
+package inventory
+
+import (
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+)
+
+// parsedGroup is a group read from an existing inventory
+type parsedGroup struct {
+	hosts     []string
+	children  []string
+	variables map[string]interface{}
+}
+
+// parsedInventory is an existing inventory read by one of the decoders, before it is added to a database. Groups and
+// hosts are kept in the order they were declared.
+type parsedInventory struct {
+	groups     map[string]*parsedGroup
+	groupOrder []string
+	hosts      map[string]map[string]interface{}
+	hostOrder  []string
+	allVars    map[string]interface{}
+}
+
+func newParsedInventory() *parsedInventory {
+	return &parsedInventory{
+		groups:  make(map[string]*parsedGroup),
+		hosts:   make(map[string]map[string]interface{}),
+		allVars: make(map[string]interface{}),
+	}
+}
+
+// group returns the named group, declaring it if it does not exist
+func (s *parsedInventory) group(name string) *parsedGroup {
+	if g, ok := s.groups[name]; ok {
+		return g
+	}
+	g := &parsedGroup{variables: make(map[string]interface{})}
+	s.groups[name] = g
+	s.groupOrder = append(s.groupOrder, name)
+	return g
+}
+
+// addHost adds a host to a group, merging its variables with those from earlier declarations of the host
+func (s *parsedInventory) addHost(group string, name string, variables map[string]interface{}) {
+	vars, ok := s.hosts[name]
+	if !ok {
+		vars = make(map[string]interface{})
+		s.hosts[name] = vars
+		s.hostOrder = append(s.hostOrder, name)
+	}
+	for k, v := range variables {
+		vars[k] = v
+	}
+
+	g := s.group(group)
+	for _, h := range g.hosts {
+		if h == name {
+			return
+		}
+	}
+	g.hosts = append(g.hosts, name)
+}
+
+// addChild makes child a child group of group
+func (s *parsedInventory) addChild(group string, child string) {
+	g := s.group(group)
+	for _, c := range g.children {
+		if c == child {
+			return
+		}
+	}
+	g.children = append(g.children, child)
+}
+
+// apply adds the groups and hosts to the database. Groups and hosts which already exist in the database, matched by
+// name, are updated instead of added again, so an inventory can be imported more than once.
+func (s *parsedInventory) apply(db *database.Database) error {
+	hosts := make(map[string]*database.Host)
+	for _, name := range s.hostOrder {
+		h, err := db.FindHostByName(name)
+		if err != nil {
+			h = database.NewHost(name, nil)
+		}
+		vars := make(map[string]interface{})
+		for k, v := range h.GetVariables() {
+			vars[k] = v
+		}
+		for k, v := range s.hosts[name] {
+			vars[k] = v
+		}
+		h.SetVariables(vars)
+		hosts[name] = h
+	}
+
+	ids := make(map[string]string)
+	for _, name := range s.groupOrder {
+		pg := s.groups[name]
+		g, err := db.FindGroupByName(name)
+		if err != nil {
+			g = database.NewGroup(name)
+			if err := db.AddGroup(*g); err != nil {
+				return fmt.Errorf("failed to add group '%s': %s", name, err.Error())
+			}
+		}
+
+		vars := make(map[string]interface{})
+		for k, v := range g.GetVariables() {
+			vars[k] = v
+		}
+		for k, v := range pg.variables {
+			vars[k] = v
+		}
+		g.SetVariables(vars)
+
+		for _, hn := range pg.hosts {
+			g.UpdateEntity(hosts[hn])
+		}
+		db.UpdateGroup(*g)
+		ids[name] = g.GetID()
+	}
+
+	for _, name := range s.groupOrder {
+		pg := s.groups[name]
+		if len(pg.children) == 0 {
+			continue
+		}
+		g := db.Group(ids[name])
+		children := g.GetChildren()
+		for _, c := range pg.children {
+			children = append(children, ids[c])
+		}
+		if err := db.SetChildren(g.GetID(), children); err != nil {
+			return fmt.Errorf("failed to set children of group '%s': %s", name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	iniSection   = regexp.MustCompile(`^\[([^:\]\s]+)(?::(\w+))?\]\s*(?:[#;].*)?$`)
+	iniGroupName = regexp.MustCompile(`^([^:\]\s]+)\s*(?:[#;].*)?$`)
+	iniHostPort  = regexp.MustCompile(`^(.+):(\d+)$`)
+)
+
+// DecodeINI parses an Ansible INI inventory and adds its groups, hosts, children and variables to the database.
+// Groups and hosts which already exist in the database are matched by name and updated. The variables from the
+// [all:vars] section are returned, as the database has no group for them.
+func DecodeINI(data []byte, db *database.Database) (map[string]interface{}, error) {
+	inv, err := parseINI(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := inv.apply(db); err != nil {
+		return nil, err
+	}
+	return inv.allVars, nil
+}
+
+// parseINI parses an INI inventory the way the Ansible ini inventory plugin does
+func parseINI(data []byte) (*parsedInventory, error) {
+	inv := newParsedInventory()
+	declared := map[string]bool{"all": true, "ungrouped": true}
+	type reference struct {
+		line  int
+		group string
+		kind  string
+	}
+	var references []reference
+
+	group, kind := "ungrouped", "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if m := iniSection.FindStringSubmatch(line); m != nil {
+			group, kind = m[1], m[2]
+			if kind == "" {
+				kind = "hosts"
+			}
+			switch kind {
+			case "hosts", "children":
+				declared[group] = true
+				if group != "all" && group != "ungrouped" {
+					inv.group(group)
+				}
+			case "vars":
+				references = append(references, reference{n, group, "vars"})
+			default:
+				return nil, fmt.Errorf("line %d: section [%s:%s] has unknown type: %s", n, group, kind, kind)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			return nil, fmt.Errorf("line %d: invalid section entry: '%s'", n, line)
+		}
+
+		switch kind {
+		case "hosts":
+			hosts, vars, err := parseINIHost(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+			target := group
+			if target == "all" {
+				// hosts which are only members of all are ungrouped
+				target = "ungrouped"
+			}
+			for _, h := range hosts {
+				inv.addHost(target, h, vars)
+			}
+		case "children":
+			m := iniGroupName.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: '%s' is not a valid group name", n, line)
+			}
+			references = append(references, reference{n, m[1], "children"})
+			if group != "all" {
+				inv.addChild(group, m[1])
+			}
+		case "vars":
+			k, v, err := parseINIVariable(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err.Error())
+			}
+			if group == "all" {
+				inv.allVars[k] = v
+			} else {
+				inv.group(group).variables[k] = v
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %s", err.Error())
+	}
+
+	for _, r := range references {
+		if declared[r.group] {
+			continue
+		}
+		if r.kind == "vars" {
+			return nil, fmt.Errorf("line %d: section [%s:vars] not valid for undefined group: %s", r.line, r.group, r.group)
+		}
+		return nil, fmt.Errorf("line %d: children include undefined group: %s", r.line, r.group)
+	}
+	return inv, nil
+}
+
+// parseINIHost parses a host line into the expanded host names and the host variables
+func parseINIHost(line string) ([]string, map[string]interface{}, error) {
+	tokens, err := splitShell(line)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing host definition '%s': %s", line, err.Error())
+	}
+	if len(tokens) == 0 {
+		return nil, nil, nil
+	}
+
+	pattern, port := splitHostPort(tokens[0])
+	hosts, err := expandHostPattern(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vars := make(map[string]interface{})
+	if port != "" {
+		p, _ := strconv.Atoi(port)
+		vars["ansible_port"] = float64(p)
+	}
+	for _, t := range tokens[1:] {
+		k, v, ok := strings.Cut(t, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("expected key=value host variable assignment, got: %s", t)
+		}
+		vars[k] = parseValue(v)
+	}
+	return hosts, vars, nil
+}
+
+// parseINIVariable parses a line of a [group:vars] section
+func parseINIVariable(line string) (string, interface{}, error) {
+	k, v, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", nil, fmt.Errorf("expected key=value, got: %s", line)
+	}
+	return strings.TrimSpace(k), parseValue(strings.TrimSpace(v)), nil
+}
+
+// splitHostPort splits the port from a host pattern such as host:2222 or [::1]:2222. Plain IPv6 addresses have no
+// port.
+func splitHostPort(pattern string) (string, string) {
+	depth, colons := 0, 0
+	for _, c := range pattern {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ':' && depth == 0:
+			colons++
+		}
+	}
+
+	m := iniHostPort.FindStringSubmatch(pattern)
+	if m == nil {
+		return pattern, ""
+	}
+	if strings.HasPrefix(m[1], "[") && strings.HasSuffix(m[1], "]") && strings.Contains(m[1], ":") &&
+		!strings.Contains(m[1][1:len(m[1])-1], "[") {
+		// bracketed IPv6 address
+		return m[1][1 : len(m[1])-1], m[2]
+	}
+	if colons != 1 {
+		return pattern, ""
+	}
+	return m[1], m[2]
+}
+
+// expandHostPattern expands host ranges such as db-[01:10:2].example.com or web-[a:c], including several ranges in
+// one pattern
+func expandHostPattern(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	if start < 0 {
+		return []string{pattern}, nil
+	}
+	end := strings.Index(pattern[start:], "]")
+	if end < 0 {
+		return nil, fmt.Errorf("host range '%s' is missing a closing bracket", pattern)
+	}
+	end += start
+	head, bounds, tail := pattern[:start], strings.Split(pattern[start+1:end], ":"), pattern[end+1:]
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil, fmt.Errorf("host range must be begin:end or begin:end:step in '%s'", pattern)
+	}
+
+	beg, last, step := bounds[0], bounds[1], "1"
+	if len(bounds) == 3 {
+		step = bounds[2]
+	}
+	if beg == "" {
+		beg = "0"
+	}
+	if last == "" {
+		return nil, fmt.Errorf("host range must specify end value in '%s'", pattern)
+	}
+	stride, err := strconv.Atoi(step)
+	if err != nil || stride < 1 {
+		return nil, fmt.Errorf("host range step must be a positive number in '%s'", pattern)
+	}
+
+	var seq []string
+	if isLetter(beg) && isLetter(last) {
+		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		b, e := strings.Index(letters, beg), strings.Index(letters, last)
+		if b > e {
+			return nil, fmt.Errorf("host range must have begin <= end in '%s'", pattern)
+		}
+		for i := b; i <= e; i += stride {
+			seq = append(seq, letters[i:i+1])
+		}
+	} else {
+		b, errB := strconv.Atoi(beg)
+		e, errE := strconv.Atoi(last)
+		if errB != nil || errE != nil {
+			return nil, fmt.Errorf("host range must be numeric or a single letter in '%s'", pattern)
+		}
+		if b > e {
+			return nil, fmt.Errorf("host range must have begin <= end in '%s'", pattern)
+		}
+		width := 0
+		if len(beg) > 1 && beg[0] == '0' {
+			if len(beg) != len(last) {
+				return nil, fmt.Errorf("host range must specify equal-length begin and end formats in '%s'", pattern)
+			}
+			width = len(beg)
+		}
+		for i := b; i <= e; i += stride {
+			seq = append(seq, fmt.Sprintf("%0*d", width, i))
+		}
+	}
+
+	var hosts []string
+	for _, s := range seq {
+		expanded, err := expandHostPattern(head + s + tail)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, expanded...)
+	}
+	return hosts, nil
+}
+
+func isLetter(s string) bool {
+	return len(s) == 1 && ((s[0] >= 'a' && s[0] <= 'z') || (s[0] >= 'A' && s[0] <= 'Z'))
+}
+
+// splitShell splits a line into words the way Python's shlex.split does with comments enabled, which is how Ansible
+// reads host lines
+func splitShell(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '#':
+			if inWord {
+				words = append(words, word.String())
+			}
+			return words, nil
+		case c == '\\':
+			if i+1 >= len(line) {
+				return nil, fmt.Errorf("no escaped character")
+			}
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("no closing quotation")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			closed := false
+			for i++; i < len(line); i++ {
+				if line[i] == '"' {
+					closed = true
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("no closing quotation")
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
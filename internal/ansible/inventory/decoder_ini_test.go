@@ -0,0 +1,133 @@
+package inventory
+
+import (
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const TestINIData = `# hand written inventory
+standalone.example.com
+
+[master]
+master-1 ansible_host=192.168.0.180 k3s_role=server
+
+[node]
+node-[01:03] ansible_user=ubuntu
+web-[a:b].example.com:2222 description="'front end, don\'t touch'" ports="[80, 443]"
+
+[k3s_cluster:children]
+master
+node  # the workers
+
+[k3s_cluster:vars]
+k3s_version = v1.19.5+k3s1
+debug=False
+
+[all:vars]
+ansible_python_interpreter=/usr/bin/python3
+`
+
+func TestDecodeINI(t *testing.T) {
+	db := database.NewDatabase(InventoryRootPath)
+	allVars, err := DecodeINI([]byte(TestINIData), db)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ansible_python_interpreter": "/usr/bin/python3"}, allVars)
+
+	ungrouped, err := db.FindGroupByName("ungrouped")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(ungrouped.GetHosts()))
+
+	master, err := db.FindGroupByName("master")
+	assert.NoError(t, err)
+	m, err := master.FindEntityByName("master-1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ansible_host": "192.168.0.180", "k3s_role": "server"}, m.(*database.Host).GetVariables())
+
+	node, err := db.FindGroupByName("node")
+	assert.NoError(t, err)
+	var names []string
+	for _, h := range node.GetHosts() {
+		names = append(names, h.GetName())
+	}
+	assert.Equal(t, []string{"node-01", "node-02", "node-03", "web-a.example.com", "web-b.example.com"}, names)
+
+	web, err := db.FindHostByName("web-b.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2222), web.GetVariables()["ansible_port"])
+	assert.Equal(t, "front end, don't touch", web.GetVariables()["description"])
+	assert.Equal(t, []interface{}{float64(80), float64(443)}, web.GetVariables()["ports"])
+
+	cluster, err := db.FindGroupByName("k3s_cluster")
+	assert.NoError(t, err)
+	assert.True(t, cluster.HasChild(master.GetID()))
+	assert.True(t, cluster.HasChild(node.GetID()))
+	assert.Equal(t, map[string]interface{}{"k3s_version": "v1.19.5+k3s1", "debug": false}, cluster.GetVariables())
+}
+
+func TestDecodeINIMergesExistingDatabase(t *testing.T) {
+	db := database.NewDatabase(InventoryRootPath)
+	_, err := DecodeINI([]byte("[master]\nmaster-1 a=1\n"), db)
+	assert.NoError(t, err)
+	_, err = DecodeINI([]byte("[master]\nmaster-1 b=2\n[node]\nmaster-1\n"), db)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(*db.AllGroups()))
+	h, err := db.FindHostByName("master-1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": float64(2)}, h.GetVariables())
+	assert.Equal(t, 2, len(db.FindGroupsByEntryID(h.GetID())))
+}
+
+func TestDecodeINIErrors(t *testing.T) {
+	cases := []string{
+		"[master:unknown]\n",
+		"[master:children]\nundefined\n",
+		"[undefined:vars]\na=1\n",
+		"[master:vars]\n[master]\n[master:vars]\nnot_an_assignment\n",
+		"[master]\nmaster-1 not_an_assignment\n",
+		"[master]\nmaster-1 a='unterminated\n",
+		"[master]\nnode-[3:1]\n",
+		"[master]\nnode-[01:100]\n",
+		"[a:children]\nb\n[b:children]\na\n",
+	}
+	for _, c := range cases {
+		_, err := DecodeINI([]byte(c), database.NewDatabase(InventoryRootPath))
+		assert.Error(t, err, c)
+	}
+}
+
+func TestSplitShell(t *testing.T) {
+	words, err := splitShell(`host a="x\y\"z" b=it\ s c='a\b' d=b#c e=1`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host", `a=x\y"z`, "b=it s", `c=a\b`, "d=b"}, words)
+}
+
+func TestParseValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"master-1", "master-1"},
+		{"192.168.0.180", "192.168.0.180"},
+		{"22", float64(22)},
+		{"-1.5e3", float64(-1500)},
+		{"0x10", float64(16)},
+		{"010", "010"},
+		{"1j", "1j"},
+		{"True", true},
+		{"None", nil},
+		{"'it\\'s'", "it's"},
+		{`"a\nb\x41é"`, "a\nbAé"},
+		{`r'\d+'`, `\d+`},
+		{"'a' 'b'", "ab"},
+		{"[1, 'two', (3, 4)]", []interface{}{float64(1), "two", []interface{}{float64(3), float64(4)}}},
+		{"{'a': {1: None}}", map[string]interface{}{"a": map[string]interface{}{"1": nil}}},
+		{"{1, 2}", "{1, 2}"},
+		{"[1, 2", "[1, 2"},
+		{"name", "name"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, parseValue(c.value), c.value)
+	}
+}
@@ -3,10 +3,20 @@ package inventory
 import (
 	"fmt"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
+// lockFile is the advisory lock file which serializes changes to the inventories under a root path between
+// provider processes. It is kept when an inventory is deleted, so a waiting process never locks a removed file.
+const lockFile = ".terraform-provider-ansible.lock"
+
+// GroupVarsFileName is the file in the group_vars folder of the all group holding the group vars of the inventory
+const GroupVarsFileName = "all.yml"
+
 // Inventory represents an Ansible inventory
 type Inventory struct {
 	id            string
@@ -14,20 +24,16 @@ type Inventory struct {
 	groupVarsFile string
 }
 
-// Exists checks if an inventory with the given ID already exists
+// Exists checks if an inventory with the given ID already exists at rootPath or in one of its subdirectories
 func Exists(rootPath string, id string) bool {
-	_, err := os.Stat(rootPath)
-	if err != nil {
-		return false
-	}
-	actualID, err := getId(rootPath)
-	if err != nil {
-		return false
-	}
-	if actualID != id {
-		return false
-	}
-	return true
+	_, err := resolvePath(rootPath, id)
+	return err == nil
+}
+
+// IsInventory checks if path holds an inventory itself, not counting the named inventories in its subdirectories
+func IsInventory(path string) bool {
+	_, err := getId(path)
+	return err == nil
 }
 
 // NewInventory creates a new inventory at the given rootPath
@@ -35,12 +41,12 @@ func NewInventory(rootPath string) Inventory {
 	return Inventory{
 		id:            database.NewIdentity().GetID(),
 		rootPath:      filepath.Clean(rootPath),
-		groupVarsFile: fmt.Sprintf("%s%sall.yml", GetGroupVarsPath(rootPath, "all"), string(os.PathSeparator)),
+		groupVarsFile: filepath.Join(GetGroupVarsPath(rootPath, "all"), GroupVarsFileName),
 	}
 }
 
 func writeId(rootPath string, id string) error {
-	return os.WriteFile(fmt.Sprintf("%s/id", filepath.Clean(rootPath)), []byte(id), os.ModePerm)
+	return util.WriteFileAtomic(fmt.Sprintf("%s/id", filepath.Clean(rootPath)), []byte(id), os.ModePerm)
 }
 
 func getId(rootPath string) (string, error) {
@@ -51,25 +57,138 @@ func getId(rootPath string) (string, error) {
 	return string(data), err
 }
 
-// Load loads an inventory from disk
+// Load loads an inventory from disk. The inventory is either at rootPath or, for a named inventory, in one of its
+// subdirectories, which is found by the ID of the inventory.
 func Load(rootPath string, id string) (*Inventory, error) {
-	actualID, err := getId(rootPath)
+	path, err := resolvePath(rootPath, id)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := os.Stat(rootPath); os.IsExist(err) {
-		return nil, fmt.Errorf("inventory not found at the expected location '%s': %s", rootPath, err.Error())
-	}
-	if actualID != id {
-		return nil, fmt.Errorf("inventory found, but ID is incorrect (id=%s, actualID=%s)", id, actualID)
-	}
 	return &Inventory{
 		id:            id,
-		rootPath:      filepath.Clean(rootPath),
-		groupVarsFile: fmt.Sprintf("%s%sall.yml", GetGroupVarsPath(rootPath, "all"), string(os.PathSeparator)),
+		rootPath:      path,
+		groupVarsFile: filepath.Join(GetGroupVarsPath(path, "all"), GroupVarsFileName),
 	}, nil
 }
 
+// Find loads the inventory at rootPath without knowing its ID. When rootPath holds no inventory itself, the only
+// named inventory in its subdirectories is loaded.
+func Find(rootPath string) (*Inventory, error) {
+	if id, err := getId(rootPath); err == nil {
+		return Load(rootPath, id)
+	}
+
+	named, err := namedInventories(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("no inventory found at '%s': %s", rootPath, err.Error())
+	}
+	switch len(named) {
+	case 0:
+		return nil, fmt.Errorf("no inventory found at '%s'", rootPath)
+	case 1:
+		for id := range named {
+			return Load(rootPath, id)
+		}
+	}
+	return nil, fmt.Errorf("found %d inventories at '%s', select one by its ID", len(named), rootPath)
+}
+
+// All loads the inventory at rootPath and every named inventory in its subdirectories, ordered by path
+func All(rootPath string) ([]*Inventory, error) {
+	var all []*Inventory
+	if id, err := getId(rootPath); err == nil {
+		i, err := Load(rootPath, id)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, i)
+	}
+
+	named, err := namedInventories(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("no inventory found at '%s': %s", rootPath, err.Error())
+	}
+	paths := make([]string, 0, len(named))
+	ids := make(map[string]string, len(named))
+	for id, path := range named {
+		paths = append(paths, path)
+		ids[path] = id
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		i, err := Load(rootPath, ids[path])
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, i)
+	}
+	return all, nil
+}
+
+// resolvePath returns the directory of the inventory with the given ID, which is either rootPath itself or the
+// subdirectory of a named inventory
+func resolvePath(rootPath string, id string) (string, error) {
+	if actualID, err := getId(rootPath); err == nil && actualID == id {
+		return filepath.Clean(rootPath), nil
+	}
+
+	named, err := namedInventories(rootPath)
+	if err != nil {
+		return "", fmt.Errorf("inventory '%s' not found at '%s': %s", id, rootPath, err.Error())
+	}
+	if path, ok := named[id]; ok {
+		return path, nil
+	}
+	return "", fmt.Errorf("inventory '%s' not found at '%s'", id, rootPath)
+}
+
+// namedInventories returns the directories of the named inventories in the subdirectories of rootPath, by their ID
+func namedInventories(rootPath string) (map[string]string, error) {
+	entries, err := os.ReadDir(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	named := make(map[string]string)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(filepath.Clean(rootPath), e.Name())
+		if id, err := getId(path); err == nil {
+			named[id] = path
+		}
+	}
+	return named, nil
+}
+
+// RootPath returns the provider path holding the inventory at path, which is the parent directory for a named
+// inventory. A provider path is recognized by its lock file, which is created the first time the provider locks it.
+func RootPath(path string) string {
+	path = filepath.Clean(path)
+	if _, err := os.Stat(filepath.Join(path, lockFile)); err == nil {
+		return path
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), lockFile)); err == nil {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// Lock acquires the advisory lock for the inventories under rootPath, waiting up to timeout for other provider
+// processes to release it
+func Lock(rootPath string, timeout time.Duration) (*util.FileLock, error) {
+	if err := os.MkdirAll(rootPath, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create inventory rootPath: %s", err.Error())
+	}
+
+	l := util.NewFileLock(filepath.Join(filepath.Clean(rootPath), lockFile))
+	if err := l.Lock(timeout); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
 // GetID returns the ID of the inventory
 func (s *Inventory) GetID() string {
 	return s.id
@@ -91,10 +210,14 @@ func GetGroupVarsPath(path string, group string) string {
 	}
 }
 
-// GetAndLoadDatabase creates a new database and loads data from disk
-func (s *Inventory) GetAndLoadDatabase() (*database.Database, error) {
-	db := database.NewDatabase(s.GetInventoryPath())
-	err := db.Load()
+// GetAndLoadDatabase opens the database of the inventory and loads data from disk. The given kind of storage is only
+// used when the database does not exist yet.
+func (s *Inventory) GetAndLoadDatabase(storage string) (*database.Database, error) {
+	db, err := database.Open(s.GetInventoryPath(), storage)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Load()
 	return db, err
 }
 
@@ -113,6 +236,17 @@ func (s *Inventory) Load() (string, error) {
 
 // Commit saves groupVars for the inventory to disk
 func (s *Inventory) Commit(groupVars string) error {
+	if err := s.commitID(); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(s.groupVarsFile, []byte(groupVars), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to commit inventory to file: %s", err.Error())
+	}
+	return nil
+}
+
+// commitID creates the folders of the inventory and saves its ID to disk
+func (s *Inventory) commitID() error {
 	if err := os.MkdirAll(s.GetInventoryPath(), os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create inventory rootPath: %s", err.Error())
 	}
@@ -122,8 +256,79 @@ func (s *Inventory) Commit(groupVars string) error {
 	if err := writeId(s.rootPath, s.id); err != nil {
 		return fmt.Errorf("failed to write inventory id: %s", err.Error())
 	}
-	if err := os.WriteFile(s.groupVarsFile, []byte(groupVars), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to commit inventory to file: %s", err.Error())
+	return nil
+}
+
+// CommitGroupVarsFiles saves the inventory to disk with the given files, by file name, in the group_vars folder of
+// the all group. Everything else in the folder is removed, so it only holds the given files.
+func (s *Inventory) CommitGroupVarsFiles(files map[string][]byte) error {
+	if err := s.commitID(); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := s.CommitGroupVarsFile(name, data); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(GetGroupVarsPath(s.rootPath, "all"))
+	if err != nil {
+		return fmt.Errorf("failed to list group_vars files: %s", err.Error())
+	}
+	for _, e := range entries {
+		if _, ok := files[e.Name()]; ok {
+			continue
+		}
+		if err := os.RemoveAll(s.getGroupVarsFile(e.Name())); err != nil {
+			return fmt.Errorf("failed to remove group_vars file '%s': %s", e.Name(), err.Error())
+		}
+	}
+	return nil
+}
+
+// LoadGroupVarsFiles loads every file in the group_vars folder of the all group, by file name
+func (s *Inventory) LoadGroupVarsFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	entries, err := os.ReadDir(GetGroupVarsPath(s.rootPath, "all"))
+	if os.IsNotExist(err) {
+		return files, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list group_vars files: %s", err.Error())
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(s.getGroupVarsFile(e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load group_vars file '%s': %s", e.Name(), err.Error())
+		}
+		files[e.Name()] = data
+	}
+	return files, nil
+}
+
+// getGroupVarsFile returns the path of a file in the group_vars folder of the all group
+func (s *Inventory) getGroupVarsFile(name string) string {
+	return filepath.Join(GetGroupVarsPath(s.rootPath, "all"), name)
+}
+
+// LoadGroupVarsFile loads a file from the group_vars folder of the all group, returning nil if it does not exist
+func (s *Inventory) LoadGroupVarsFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(s.getGroupVarsFile(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// CommitGroupVarsFile saves a file to the group_vars folder of the all group
+func (s *Inventory) CommitGroupVarsFile(name string, data []byte) error {
+	if err := os.MkdirAll(GetGroupVarsPath(s.rootPath, "all"), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create inventory group_vars rootPath: %s", err.Error())
+	}
+	if err := util.WriteFileAtomic(s.getGroupVarsFile(name), data, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to commit group_vars file '%s': %s", name, err.Error())
 	}
 	return nil
 }
@@ -133,9 +338,22 @@ func (s Inventory) deleteInventory() error {
 		return nil
 	}
 
-	if err := os.RemoveAll(s.rootPath); err != nil {
+	entries, err := os.ReadDir(s.rootPath)
+	if err != nil {
 		return fmt.Errorf("failed to delete inventory: %s", err.Error())
 	}
+	for _, e := range entries {
+		// named inventories in subdirectories are not part of this inventory
+		if e.Name() == lockFile || (e.IsDir() && IsInventory(filepath.Join(s.rootPath, e.Name()))) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.rootPath, e.Name())); err != nil {
+			return fmt.Errorf("failed to delete inventory: %s", err.Error())
+		}
+	}
+
+	// the root path is only removed if it is empty, as the lock file is kept
+	_ = os.Remove(s.rootPath)
 	return nil
 }
 
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const InventoryRootPath = "/tmp/inventory"
@@ -67,3 +69,104 @@ func TestCreateNewInventory(t *testing.T) {
 		assert.Fail(t, "inventory group_vars exists even after delete")
 	}
 }
+
+func TestInventoryLock(t *testing.T) {
+	l, err := Lock(InventoryRootPath, time.Second)
+	assert.NoError(t, err)
+
+	// a second provider process has to wait for the lock to be released
+	_, err = Lock(InventoryRootPath, 100*time.Millisecond)
+	assert.Error(t, err)
+
+	// deleting the inventory keeps the lock file, so the lock stays valid for waiting processes
+	i := NewInventory(InventoryRootPath)
+	assert.NoError(t, i.Commit(TestGroupVarsData))
+	assert.NoError(t, i.Delete())
+	assert.False(t, Exists(InventoryRootPath, i.GetID()))
+	assert.FileExists(t, filepath.Join(InventoryRootPath, lockFile))
+
+	assert.NoError(t, l.Unlock())
+	l2, err := Lock(InventoryRootPath, time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, l2.Unlock())
+}
+
+func TestInventoryRootPath(t *testing.T) {
+	assert.NoError(t, os.RemoveAll(InventoryRootPath))
+	named := filepath.Join(InventoryRootPath, "staging")
+	assert.NoError(t, os.MkdirAll(named, os.ModePerm))
+	defer os.RemoveAll(InventoryRootPath)
+
+	// without a lock file the path is taken as the provider path
+	assert.Equal(t, named, RootPath(named))
+
+	l, err := Lock(InventoryRootPath, time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Unlock())
+	assert.Equal(t, InventoryRootPath, RootPath(named))
+	assert.Equal(t, InventoryRootPath, RootPath(InventoryRootPath+"/"))
+}
+
+func TestInventoryGroupVarsFiles(t *testing.T) {
+	i := NewInventory(InventoryRootPath)
+	defer i.Delete()
+	assert.NoError(t, i.Commit(TestGroupVarsData))
+	assert.NoError(t, i.CommitGroupVarsFile("stray.yml", []byte("---\n")))
+
+	// every file which is not given is removed from group_vars/all
+	assert.NoError(t, i.CommitGroupVarsFiles(map[string][]byte{GroupVarsFileName: []byte(TestGroupVarsData), "main.yml": []byte("---\n")}))
+	files, err := i.LoadGroupVarsFiles()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{GroupVarsFileName: []byte(TestGroupVarsData), "main.yml": []byte("---\n")}, files)
+	assert.True(t, Exists(InventoryRootPath, i.GetID()))
+
+	assert.NoError(t, i.CommitGroupVarsFiles(map[string][]byte{}))
+	files, err = i.LoadGroupVarsFiles()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.NoFileExists(t, i.groupVarsFile)
+}
+
+func TestNamedInventories(t *testing.T) {
+	defer os.RemoveAll(InventoryRootPath)
+
+	root := NewInventory(InventoryRootPath)
+	assert.NoError(t, root.Commit(TestGroupVarsData))
+	staging := NewInventory(filepath.Join(InventoryRootPath, "staging"))
+	assert.NoError(t, staging.Commit(TestGroupVarsData))
+	production := NewInventory(filepath.Join(InventoryRootPath, "production"))
+	assert.NoError(t, production.Commit(TestGroupVarsData))
+
+	// named inventories are found by their ID in the subdirectories of the root path
+	i, err := Load(InventoryRootPath, staging.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(InventoryRootPath, "staging"), i.GetInventoryPath())
+	assert.True(t, Exists(InventoryRootPath, production.GetID()))
+	assert.False(t, Exists(InventoryRootPath, "unknown"))
+	_, err = Load(InventoryRootPath, "unknown")
+	assert.Error(t, err)
+
+	i, err = Find(InventoryRootPath)
+	assert.NoError(t, err)
+	assert.Equal(t, root.GetID(), i.GetID())
+
+	all, err := All(InventoryRootPath)
+	assert.NoError(t, err)
+	if assert.Len(t, all, 3) {
+		assert.Equal(t, []string{root.GetID(), production.GetID(), staging.GetID()}, []string{all[0].GetID(), all[1].GetID(), all[2].GetID()})
+	}
+
+	// deleting the inventory in the root path keeps the named inventories
+	assert.NoError(t, root.Delete())
+	assert.True(t, Exists(InventoryRootPath, staging.GetID()))
+	assert.True(t, Exists(InventoryRootPath, production.GetID()))
+	_, err = Find(InventoryRootPath)
+	assert.Error(t, err, "several named inventories cannot be told apart without an ID")
+
+	assert.NoError(t, staging.Delete())
+	assert.NoDirExists(t, filepath.Join(InventoryRootPath, "staging"))
+	i, err = Find(InventoryRootPath)
+	assert.NoError(t, err)
+	assert.Equal(t, production.GetID(), i.GetID())
+	assert.NoError(t, production.Delete())
+}
@@ -0,0 +1,350 @@
+package inventory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseValue evaluates a variable value the way Ansible does for INI inventories, where values which are Python
+// literals become typed values and everything else is kept as a string
+func parseValue(s string) interface{} {
+	p := &literalParser{s: s}
+	v, err := p.parse()
+	if err != nil {
+		return s
+	}
+	return v
+}
+
+// literalParser parses the subset of Python literals accepted by ast.literal_eval which can be represented as JSON.
+// Numbers are returned as float64, tuples as lists and dict keys as strings.
+type literalParser struct {
+	s   string
+	pos int
+}
+
+func (p *literalParser) parse() (interface{}, error) {
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.s[p.pos:], p.pos)
+	}
+	return v, nil
+}
+
+func (p *literalParser) skipSpace() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *literalParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *literalParser) value() (interface{}, error) {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case c == '[':
+		p.pos++
+		return p.sequence(']')
+	case c == '(':
+		p.pos++
+		return p.sequence(')')
+	case c == '{':
+		p.pos++
+		return p.dict()
+	case c == '\'' || c == '"':
+		return p.strings()
+	case c == 'r' || c == 'R' || c == 'u' || c == 'U':
+		if q := p.s[p.pos+1:]; len(q) > 0 && (q[0] == '\'' || q[0] == '"') {
+			return p.strings()
+		}
+		return p.name()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	default:
+		return p.name()
+	}
+}
+
+// sequence parses the items of a list or tuple up to the closing character
+func (p *literalParser) sequence(end byte) (interface{}, error) {
+	items := make([]interface{}, 0)
+	for {
+		p.skipSpace()
+		if p.peek() == end {
+			p.pos++
+			return items, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case end:
+		default:
+			return nil, fmt.Errorf("expected ',' or '%c' at position %d", end, p.pos)
+		}
+	}
+}
+
+func (p *literalParser) dict() (interface{}, error) {
+	items := make(map[string]interface{})
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			return items, nil
+		}
+		k, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ':' {
+			// sets are valid literals, but cannot be represented
+			return nil, fmt.Errorf("expected ':' at position %d", p.pos)
+		}
+		p.pos++
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := k.(string); !ok {
+			k = formatKey(k)
+		}
+		items[k.(string)] = v
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' at position %d", p.pos)
+		}
+	}
+}
+
+// formatKey formats a dict key which is not a string the way Python would print it
+func formatKey(k interface{}) string {
+	switch t := k.(type) {
+	case bool:
+		if t {
+			return "True"
+		}
+		return "False"
+	case nil:
+		return "None"
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func (p *literalParser) name() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.s) && isIdentChar(p.s[p.pos]) {
+		p.pos++
+	}
+	switch p.s[start:p.pos] {
+	case "True":
+		return true, nil
+	case "False":
+		return false, nil
+	case "None":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("'%s' is not a literal", p.s[start:])
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *literalParser) number() (interface{}, error) {
+	sign := 1.0
+	for p.peek() == '-' || p.peek() == '+' {
+		if p.peek() == '-' {
+			sign = -sign
+		}
+		p.pos++
+		p.skipSpace()
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		exponent := (c == '-' || c == '+') && p.pos > start && (p.s[p.pos-1] == 'e' || p.s[p.pos-1] == 'E')
+		if !isIdentChar(c) && c != '.' && !exponent {
+			break
+		}
+		p.pos++
+	}
+	lit := p.s[start:p.pos]
+	if len(lit) == 0 {
+		return nil, fmt.Errorf("expected a number at position %d", start)
+	}
+
+	lower := strings.ToLower(lit)
+	if strings.HasPrefix(lower, "0x") || strings.HasPrefix(lower, "0o") || strings.HasPrefix(lower, "0b") {
+		i, err := strconv.ParseInt(lit, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a supported number", lit)
+		}
+		return sign * float64(i), nil
+	}
+	if strings.Trim(lower, "0123456789._e+-") != "" {
+		// complex numbers and anything else Go would parse, such as inf, are not valid here
+		return nil, fmt.Errorf("'%s' is not a supported number", lit)
+	}
+	if !strings.ContainsAny(lower, ".e") && lit[0] == '0' && strings.Trim(lit, "0_") != "" {
+		// Python does not accept leading zeros on decimal integers
+		return nil, fmt.Errorf("'%s' is not a number", lit)
+	}
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a number", lit)
+	}
+	return sign * f, nil
+}
+
+// strings parses one or more adjacent string literals, which Python concatenates
+func (p *literalParser) strings() (interface{}, error) {
+	var b strings.Builder
+	for {
+		s, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(s)
+
+		p.skipSpace()
+		c := p.peek()
+		if c == '\'' || c == '"' {
+			continue
+		}
+		if (c == 'r' || c == 'R' || c == 'u' || c == 'U') && p.pos+1 < len(p.s) &&
+			(p.s[p.pos+1] == '\'' || p.s[p.pos+1] == '"') {
+			continue
+		}
+		return b.String(), nil
+	}
+}
+
+func (p *literalParser) str() (string, error) {
+	raw := false
+	switch p.peek() {
+	case 'r', 'R':
+		raw = true
+		p.pos++
+	case 'u', 'U':
+		p.pos++
+	}
+
+	quote := p.s[p.pos : p.pos+1]
+	if strings.HasPrefix(p.s[p.pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	p.pos += len(quote)
+
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.s[p.pos:], quote) {
+			p.pos += len(quote)
+			return b.String(), nil
+		}
+
+		c := p.s[p.pos]
+		if c == '\n' && len(quote) == 1 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if c != '\\' {
+			r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+			continue
+		}
+
+		if p.pos+1 >= len(p.s) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if raw {
+			b.WriteString(p.s[p.pos : p.pos+2])
+			p.pos += 2
+			continue
+		}
+		if err := p.escape(&b); err != nil {
+			return "", err
+		}
+	}
+}
+
+// escape decodes the escape sequence at the current position of a string literal
+func (p *literalParser) escape(b *strings.Builder) error {
+	e := p.s[p.pos+1]
+	p.pos += 2
+	switch e {
+	case '\n':
+	case '\\', '\'', '"':
+		b.WriteByte(e)
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'v':
+		b.WriteByte('\v')
+	case 'x', 'u', 'U':
+		n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+		if p.pos+n > len(p.s) {
+			return fmt.Errorf("truncated \\%c escape", e)
+		}
+		r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid \\%c escape", e)
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		end := p.pos - 1
+		for end < len(p.s) && end < p.pos+2 && p.s[end] >= '0' && p.s[end] <= '7' {
+			end++
+		}
+		r, _ := strconv.ParseUint(p.s[p.pos-1:end], 8, 32)
+		b.WriteRune(rune(r))
+		p.pos = end
+	default:
+		// unknown escapes are kept as is
+		b.WriteByte('\\')
+		b.WriteByte(e)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package ansible
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const NamedInventoryPath = "/tmp/named_inventory"
+
+func TestNamedInventories(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(NamedInventoryPath, os.ModePerm))
+	defer os.RemoveAll(NamedInventoryPath)
+
+	conf := providerConfiguration{Path: NamedInventoryPath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+	ids := make(map[string]string)
+	for _, name := range []string{"staging", "production"} {
+		d := ansibleInventoryResourceQuery().TestResourceData()
+		_ = d.Set("name", name)
+		_ = d.Set("group_vars", TestGroupVarsData)
+		assert.False(t, ansibleInventoryResourceQueryCreate(context.Background(), d, conf).HasError())
+		assert.Equal(t, name, d.Get("name"))
+		assert.FileExists(t, filepath.Join(NamedInventoryPath, name, "group_vars", "all", "all.yml"))
+		ids[name] = d.Id()
+	}
+
+	// a second inventory with the same name would share the directory
+	d := ansibleInventoryResourceQuery().TestResourceData()
+	_ = d.Set("name", "staging")
+	assert.True(t, ansibleInventoryResourceQueryCreate(context.Background(), d, conf).HasError())
+
+	// groups and hosts find the directory of the inventory from its ID
+	g := ansibleGroupResourceQuery().TestResourceData()
+	_ = g.Set("name", "master")
+	_ = g.Set("inventory", ids["production"])
+	assert.False(t, ansibleGroupResourceQueryCreate(context.Background(), g, conf).HasError())
+	h := ansibleHostResourceQuery().TestResourceData()
+	_ = h.Set("name", "k3s-master-1")
+	_ = h.Set("inventory", ids["production"])
+	_ = h.Set("groups", []interface{}{g.Id()})
+	assert.False(t, ansibleHostResourceQueryCreate(context.Background(), h, conf).HasError())
+
+	data, err := os.ReadFile(filepath.Join(NamedInventoryPath, "production", "hosts.ini"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[master]\nk3s-master-1\n\n", string(data))
+	assert.NoFileExists(t, filepath.Join(NamedInventoryPath, "staging", "hosts.ini"))
+	assert.NoFileExists(t, filepath.Join(NamedInventoryPath, "hosts.ini"))
+
+	// imports and data sources find a named inventory by its ID, or by its name
+	imported := ansibleInventoryResourceQuery().TestResourceData()
+	imported.SetId(ids["production"])
+	_, err = ansibleInventoryResourceQueryImport(context.Background(), imported, conf)
+	assert.NoError(t, err)
+	assert.False(t, ansibleInventoryResourceQueryRead(context.Background(), imported, conf).HasError())
+	assert.Equal(t, "production", imported.Get("name"))
+
+	ds := ansibleInventoryDataSource().TestResourceData()
+	_ = ds.Set("name", "staging")
+	assert.False(t, ansibleInventoryDataSourceRead(context.Background(), ds, conf).HasError())
+	assert.Equal(t, ids["staging"], ds.Id())
+	ds = ansibleInventoryDataSource().TestResourceData()
+	assert.True(t, ansibleInventoryDataSourceRead(context.Background(), ds, conf).HasError(), "several inventories need an ID or a name")
+
+	hosts := ansibleHostsDataSource().TestResourceData()
+	_ = hosts.Set("inventory_name", "production")
+	assert.False(t, ansibleHostsDataSourceRead(context.Background(), hosts, conf).HasError())
+	assert.Equal(t, ids["production"], hosts.Id())
+	assert.Equal(t, []interface{}{"k3s-master-1"}, hosts.Get("names"))
+	hosts = ansibleHostsDataSource().TestResourceData()
+	_ = hosts.Set("inventory", ids["staging"])
+	assert.False(t, ansibleHostsDataSourceRead(context.Background(), hosts, conf).HasError())
+	assert.Equal(t, "staging", hosts.Get("inventory_name"))
+	assert.Empty(t, hosts.Get("names"))
+	hosts = ansibleHostsDataSource().TestResourceData()
+	assert.True(t, ansibleHostsDataSourceRead(context.Background(), hosts, conf).HasError(), "several inventories need an ID or a name")
+}
+
+func TestValidateInventoryName(t *testing.T) {
+	for _, name := range []string{"staging", "prod-eu.1", "_test"} {
+		_, errs := validateInventoryName(name, "name")
+		assert.Empty(t, errs, name)
+	}
+	for _, name := range []string{"", ".", "..", "../other", "a/b", "group_vars", "host_vars"} {
+		_, errs := validateInventoryName(name, "name")
+		assert.NotEmpty(t, errs, name)
+	}
+}
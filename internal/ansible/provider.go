@@ -2,16 +2,23 @@ package ansible
 
 import (
 	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
 	"github.com/habakke/terraform-ansible-provider/internal/util"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"os"
+	"strings"
 	"sync"
 )
 
 type providerConfiguration struct {
-	Path  string
-	Mutex *sync.Mutex
+	Path          string
+	Formats       []string
+	HostVarsFiles bool
+	Storage       string
+	VaultPassword string
+	Mutex         *sync.Mutex
 }
 
 // Provider represents a terraform provider definition
@@ -30,6 +37,42 @@ func New() *schema.Provider {
 				ValidateFunc: validation.NoZeroValues,
 				Description:  "Path to where the ansible inventory files are stored",
 			},
+			"formats": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Inventory file formats to export (ini, yaml, json). Defaults to ini",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice([]string{"ini", "yaml", "json"}, false),
+				},
+			},
+			"host_vars_files": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Write host variables to host_vars/<host>.yml instead of inline in the inventory",
+			},
+			"storage": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      database.StorageJSON,
+				Description:  "Storage of new inventory databases (json, bolt). Existing databases keep their storage",
+				ValidateFunc: validation.StringInSlice(database.Storages, false),
+			},
+			"vault_password": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"vault_password_file"},
+				Description:   "Password used to encrypt sensitive variables with ansible-vault",
+			},
+			"vault_password_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("ANSIBLE_VAULT_PASSWORD_FILE", nil),
+				ConflictsWith: []string{"vault_password"},
+				Description:   "File containing the password used to encrypt sensitive variables with ansible-vault",
+			},
 			"log_caller": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -37,7 +80,10 @@ func New() *schema.Provider {
 				Default:     false,
 			},
 		},
-		DataSourcesMap: map[string]*schema.Resource{},
+		DataSourcesMap: map[string]*schema.Resource{
+			"ansible_inventory": ansibleInventoryDataSource(),
+			"ansible_hosts":     ansibleHostsDataSource(),
+		},
 		ResourcesMap: map[string]*schema.Resource{
 			"ansible_inventory": ansibleInventoryResourceQuery(),
 			"ansible_group":     ansibleGroupResourceQuery(),
@@ -53,11 +99,37 @@ func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}
 
 	// load provider config vars
 	path := util.ResourceToString(d, "path")
+	formats := util.ResourceToStringArray(d, "formats")
+	if len(formats) == 0 {
+		formats = []string{"ini"}
+	}
+
+	vaultPassword := util.ResourceToString(d, "vault_password")
+	if file := util.ResourceToString(d, "vault_password_file"); len(file) > 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, diag.Errorf("failed to read vault password file '%s': %s", file, err.Error())
+		}
+		// ansible-vault ignores surrounding whitespace, such as the trailing newline, in password files
+		vaultPassword = strings.TrimSpace(string(data))
+	}
+	util.RegisterSecrets(vaultPassword)
+	configureLogging(util.ResourceToBool(d, "log_caller"))
 
 	var mut sync.Mutex
 	conf := providerConfiguration{
-		Path:  path,
-		Mutex: &mut,
+		Path:          path,
+		Formats:       formats,
+		HostVarsFiles: util.ResourceToBool(d, "host_vars_files"),
+		Storage:       util.ResourceToString(d, "storage"),
+		VaultPassword: vaultPassword,
+		Mutex:         &mut,
 	}
 	return conf, diags
 }
+
+// configureLogging sends the zerolog output of the provider to terraform, at the level terraform logs the provider
+// at, with every registered secret redacted
+func configureLogging(logCaller bool) {
+	util.ConfigureTerraformProviderLogging(util.GetEnv("TF_LOG_PROVIDER", util.GetEnv("TF_LOG", "info")), logCaller)
+}
@@ -1,7 +1,13 @@
 package ansible
 
 import (
+	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
 	"testing"
 
@@ -33,3 +39,26 @@ func TestProvider(t *testing.T) {
 		t.Fatalf("provider internal validation failed: %v", err)
 	}
 }
+
+func TestProviderLoggingRedactsSecrets(t *testing.T) {
+	t.Setenv("TF_LOG_PROVIDER", "debug")
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stderr, logger, level := os.Stderr, log.Logger, zerolog.GlobalLevel()
+	os.Stderr = w
+	defer func() {
+		os.Stderr, log.Logger = stderr, logger
+		zerolog.SetGlobalLevel(level)
+	}()
+
+	d := schema.TestResourceDataRaw(t, New().Schema, map[string]interface{}{"path": "/tmp/provider", "vault_password": "vault-s3cr3t"})
+	_, diags := providerConfigure(context.Background(), d)
+	assert.False(t, diags.HasError())
+	log.Debug().Str("password", "vault-s3cr3t").Msg("configured vault password vault-s3cr3t")
+	assert.NoError(t, w.Close())
+
+	out, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "[DEBUG] configured vault password "+util.Redacted)
+	assert.NotContains(t, string(out), "vault-s3cr3t")
+}
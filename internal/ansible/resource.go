@@ -1,19 +1,213 @@
 package ansible
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"github.com/rs/zerolog/log"
 	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
-func commitAndExport(db *database.Database, path string) error {
+// encoder describes how the database is exported for a given inventory format
+type encoder struct {
+	file   string
+	encode func(database *database.Database, opts EncoderOptions) ([]byte, error)
+}
+
+var encoders = map[string]encoder{
+	"ini":  {file: "hosts.ini", encode: encodeINI},
+	"yaml": {file: "hosts.yml", encode: encodeYAML},
+	"json": {file: "inventory.json", encode: encodeJSON},
+}
+
+// commitAndExport commits the database and exports it. Every exported file is rendered before the database is
+// committed, so a database which cannot be exported is never saved.
+func commitAndExport(db *database.Database, path string, conf providerConfiguration) error {
+	files, err := renderFormats(db, conf)
+	if err != nil {
+		return fmt.Errorf("failed to export to ansible: %s", err.Error())
+	}
+	hostVars, err := renderHostVars(db, conf.HostVarsFiles)
+	if err != nil {
+		return fmt.Errorf("failed to export host_vars: %s", err.Error())
+	}
+
 	if err := db.Commit(); err != nil {
 		return fmt.Errorf("failed to commit database to disk: %s", err.Error())
 	}
 
-	if err := Encode(fmt.Sprintf("%s%shosts.ini", path, string(os.PathSeparator)), db); err != nil {
-		return fmt.Errorf("failed to export to ansible: %s", err.Error())
+	for name, data := range files {
+		file := fmt.Sprintf("%s%s%s", path, string(os.PathSeparator), name)
+		if err := util.WriteFileAtomic(file, data, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to export to ansible: failed to save file '%s'", file)
+		}
+	}
+
+	if err := writeHostVars(path, hostVars); err != nil {
+		return fmt.Errorf("failed to export host_vars: %s", err.Error())
 	}
 
 	return nil
 }
+
+// renderFormats renders the inventory file of every configured format, keyed by file name
+func renderFormats(db *database.Database, conf providerConfiguration) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	opts := EncoderOptions{HostVarsFiles: conf.HostVarsFiles}
+	for _, f := range conf.Formats {
+		e, ok := encoders[f]
+		if !ok {
+			return nil, fmt.Errorf("unsupported inventory format '%s'", f)
+		}
+		data, err := e.encode(db, opts)
+		if err != nil {
+			return nil, err
+		}
+		files[e.file] = data
+	}
+	return files, nil
+}
+
+// expectedExports returns the checksum of every file an export of the database writes, keyed by the path of the
+// file relative to the inventory. Nothing is exported before the database is first committed.
+func expectedExports(db *database.Database, conf providerConfiguration) (map[string]string, error) {
+	checksums := make(map[string]string)
+	if !db.Exists() {
+		return checksums, nil
+	}
+
+	files, err := renderFormats(db, conf)
+	if err != nil {
+		return nil, err
+	}
+	hostVars, err := renderHostVars(db, conf.HostVarsFiles)
+	if err != nil {
+		return nil, err
+	}
+	for name, data := range hostVars {
+		files[path.Join("host_vars", name)] = data
+	}
+
+	for name, data := range files {
+		checksums[name] = checksum(data)
+	}
+	return checksums, nil
+}
+
+// actualExports returns the checksum of the exported files found on disk, for the files an export would write.
+// Missing files are left out.
+func actualExports(inventoryPath string, expected map[string]string) map[string]string {
+	checksums := make(map[string]string)
+	for name := range expected {
+		data, err := os.ReadFile(filepath.Join(inventoryPath, filepath.FromSlash(name)))
+		if err != nil {
+			continue
+		}
+		checksums[name] = checksum(data)
+	}
+	return checksums
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lockInventory serializes changes to the inventories under the provider path, both between goroutines in this
+// provider and between provider processes sharing the path. The returned function releases the lock, and can safely
+// be called more than once.
+func lockInventory(conf providerConfiguration, timeout time.Duration) (func(), error) {
+	conf.Mutex.Lock()
+	l, err := inventory.Lock(conf.Path, timeout)
+	if err != nil {
+		conf.Mutex.Unlock()
+		return nil, fmt.Errorf("failed to lock inventory path '%s': %s", conf.Path, err.Error())
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := l.Unlock(); err != nil {
+				log.Error().Err(err).Msg("failed to release inventory lock")
+			}
+			conf.Mutex.Unlock()
+		})
+	}, nil
+}
+
+// inventoryPath returns the directory of an inventory, where a named inventory lives in a subdirectory of the
+// provider path
+func inventoryPath(conf providerConfiguration, name string) string {
+	if len(name) == 0 {
+		return conf.Path
+	}
+	return filepath.Join(conf.Path, name)
+}
+
+// inventoryName returns the name of an inventory from its directory, which is empty for the inventory at the
+// provider path
+func inventoryName(conf providerConfiguration, i *inventory.Inventory) string {
+	rel, err := filepath.Rel(filepath.Clean(conf.Path), i.GetInventoryPath())
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// loadInventoryDatabase loads the database of an inventory for imports and data sources, which do not know the
+// inventory in advance. When inventoryRef is empty the inventory with the given name is used, or the inventory at
+// the provider path when name is empty as well.
+func loadInventoryDatabase(conf providerConfiguration, inventoryRef string, name string, timeout time.Duration) (*inventory.Inventory, *database.Database, error) {
+	unlock, err := lockInventory(conf, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	var i *inventory.Inventory
+	if len(inventoryRef) == 0 {
+		i, err = inventory.Find(inventoryPath(conf, name))
+	} else {
+		i, err = inventory.Load(conf.Path, inventoryRef)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
+	}
+	db, err := i.GetAndLoadDatabase(conf.Storage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load database '%s': %s", i.GetID(), err.Error())
+	}
+	return i, db, nil
+}
+
+// findInventoryDatabase loads the database of the inventory under the provider path holding an entity, searching the
+// inventory at the provider path and every named inventory, for imports which only know the ID of the entity
+func findInventoryDatabase(conf providerConfiguration, id string, holds func(*database.Database) bool, timeout time.Duration) (*inventory.Inventory, *database.Database, error) {
+	unlock, err := lockInventory(conf, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	all, err := inventory.All(conf.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, i := range all {
+		db, err := i.GetAndLoadDatabase(conf.Storage)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load database '%s': %s", i.GetID(), err.Error())
+		}
+		if holds(db) {
+			return i, db, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unable to find '%s' in any inventory at '%s'", id, conf.Path)
+}
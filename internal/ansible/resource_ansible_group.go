@@ -2,6 +2,7 @@ package ansible
 
 import (
 	"context"
+	"fmt"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
 	"github.com/habakke/terraform-ansible-provider/internal/util"
@@ -9,6 +10,7 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/rs/zerolog/log"
+	"strings"
 	"time"
 )
 
@@ -18,8 +20,12 @@ func ansibleGroupResourceQuery() *schema.Resource {
 		ReadContext:   ansibleGroupResourceQueryRead,
 		UpdateContext: ansibleGroupResourceQueryUpdate,
 		DeleteContext: ansibleGroupResourceQueryDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: ansibleGroupResourceQueryImport,
+		},
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(10 * time.Second),
+			Read:   schema.DefaultTimeout(10 * time.Second),
 			Update: schema.DefaultTimeout(10 * time.Second),
 			Delete: schema.DefaultTimeout(10 * time.Second),
 		},
@@ -34,6 +40,26 @@ func ansibleGroupResourceQuery() *schema.Resource {
 				Required:     true,
 				ValidateFunc: validation.NoZeroValues,
 			},
+			"children": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "IDs of the groups which are children of this group",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.NoZeroValues,
+				},
+			},
+			"variables": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Description:      "Ansible group variables, exported as a [name:vars] section of the inventory",
+				ValidateDiagFunc: validateVariablesMap,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validation.NoZeroValues,
+				},
+			},
 		},
 	}
 }
@@ -45,26 +71,36 @@ func ansibleGroupResourceQueryCreate(ctx context.Context, d *schema.ResourceData
 
 	name := util.ResourceToString(d, "name")
 	inventoryRef := util.ResourceToString(d, "inventory")
+	variables := util.ResourceToInterfaceMap(d, "variables")
+
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
 
-	conf.Mutex.Lock()
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
 	if err != nil {
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
 	}
 	g := database.NewGroup(name)
+	g.SetVariables(variables)
 	if err := db.AddGroup(*g); err != nil {
 		return diag.Errorf("failed to add group '%s': %s", name, err.Error())
 	}
+	if err := db.SetChildren(g.GetID(), groupChildren(d)); err != nil {
+		return diag.Errorf("failed to set children of group '%s': %s", name, err.Error())
+	}
 
 	// Save and export database
-	if err := commitAndExport(db, i.GetInventoryPath()); err != nil {
+	if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
 		return diag.FromErr(err)
 	}
-	conf.Mutex.Unlock()
+	unlock()
 
 	d.SetId(g.GetID())
 	d.MarkNewResource()
@@ -79,23 +115,37 @@ func ansibleGroupResourceQueryRead(ctx context.Context, d *schema.ResourceData,
 
 	inventoryRef := util.ResourceToString(d, "inventory")
 
-	conf.Mutex.Lock()
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutRead))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
+	if !inventory.Exists(conf.Path, inventoryRef) {
+		log.Warn().Str("id", d.Id()).Str("inventory", inventoryRef).Msg("inventory of group no longer exists, removing it from state")
+		d.SetId("")
+		return diags
+	}
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
-	conf.Mutex.Unlock()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
+	unlock()
 	if err != nil {
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
 	}
 
 	g := db.Group(d.Id())
 	if g == nil {
-		return diag.Errorf("unable to find group '%s'", d.Id())
+		log.Warn().Str("id", d.Id()).Msg("group no longer exists, removing it from state")
+		d.SetId("")
+		return diags
 	}
 
 	_ = d.Set("name", g.GetName())
+	_ = d.Set("children", g.GetChildren())
+	_ = d.Set("variables", g.GetVariables())
 
 	return diags
 }
@@ -108,13 +158,19 @@ func ansibleGroupResourceQueryUpdate(ctx context.Context, d *schema.ResourceData
 	id := d.Id()
 	name := util.ResourceToString(d, "name")
 	inventoryRef := util.ResourceToString(d, "inventory")
+	variables := util.ResourceToInterfaceMap(d, "variables")
+
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
 
-	conf.Mutex.Lock()
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load database")
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
@@ -125,16 +181,21 @@ func ansibleGroupResourceQueryUpdate(ctx context.Context, d *schema.ResourceData
 		return diag.Errorf("unable to group with id '%s'", id)
 	}
 
-	if d.HasChange("name") {
+	if d.HasChanges("name", "children", "variables") {
 		g.SetName(name)
+		g.SetVariables(variables)
 		db.UpdateGroup(*g)
 
+		if err := db.SetChildren(g.GetID(), groupChildren(d)); err != nil {
+			return diag.Errorf("failed to set children of group '%s': %s", name, err.Error())
+		}
+
 		// Save and export database
-		if err := commitAndExport(db, i.GetInventoryPath()); err != nil {
+		if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
 			return diag.FromErr(err)
 		}
 	}
-	conf.Mutex.Unlock()
+	unlock()
 
 	return ansibleGroupResourceQueryRead(ctx, d, meta)
 }
@@ -149,12 +210,17 @@ func ansibleGroupResourceQueryDelete(ctx context.Context, d *schema.ResourceData
 
 	log.Debug().Str("id", d.Id()).Str("inventory", inventoryRef).Msg("deleting group")
 
-	conf.Mutex.Lock()
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load database")
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
@@ -172,10 +238,54 @@ func ansibleGroupResourceQueryDelete(ctx context.Context, d *schema.ResourceData
 	}
 
 	// Save and export database
-	if err := commitAndExport(db, i.GetInventoryPath()); err != nil {
+	if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
 		return diag.FromErr(err)
 	}
-	conf.Mutex.Unlock()
+	unlock()
 
 	return diags
 }
+
+// ansibleGroupResourceQueryImport imports a group by its ID, or by <inventory_id>/<group_name>
+func ansibleGroupResourceQueryImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	conf := meta.(providerConfiguration)
+
+	var i *inventory.Inventory
+	var db *database.Database
+	var err error
+	inventoryRef, name, byName := strings.Cut(d.Id(), "/")
+	if byName {
+		i, db, err = loadInventoryDatabase(conf, inventoryRef, "", d.Timeout(schema.TimeoutRead))
+	} else {
+		i, db, err = findInventoryDatabase(conf, d.Id(), func(db *database.Database) bool {
+			return db.Group(d.Id()) != nil
+		}, d.Timeout(schema.TimeoutRead))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var g *database.Group
+	if byName {
+		if g, err = db.FindGroupByName(name); err != nil {
+			return nil, err
+		}
+	} else if g = db.Group(d.Id()); g == nil {
+		return nil, fmt.Errorf("unable to find group '%s'", d.Id())
+	}
+
+	d.SetId(g.GetID())
+	_ = d.Set("inventory", i.GetID())
+	return []*schema.ResourceData{d}, nil
+}
+
+// groupChildren returns the IDs of the child groups from the children attribute
+func groupChildren(d *schema.ResourceData) []string {
+	var children []string
+	if set, ok := d.Get("children").(*schema.Set); ok {
+		for _, v := range set.List() {
+			children = append(children, v.(string))
+		}
+	}
+	return children
+}
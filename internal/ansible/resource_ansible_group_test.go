@@ -26,6 +26,23 @@ func TestAnsibleGroup_Basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet("ansible_group.master", "inventory"),
 				),
 			},
+			{
+				ResourceName:      "ansible_group.master",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "ansible_group.master",
+				ImportState:       true,
+				ImportStateVerify: true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					rs, ok := s.RootModule().Resources["ansible_group.master"]
+					if !ok {
+						return "", fmt.Errorf("not found: ansible_group.master")
+					}
+					return fmt.Sprintf("%s/%s", rs.Primary.Attributes["inventory"], rs.Primary.Attributes["name"]), nil
+				},
+			},
 		},
 	})
 }
@@ -51,6 +68,28 @@ func TestAnsibleGroup_Update(t *testing.T) {
 					testAnsibleGroupExists("ansible_group.master"),
 					resource.TestCheckResourceAttr("ansible_group.master", "name", "master2"),
 					resource.TestCheckResourceAttrSet("ansible_group.master", "inventory"),
+					resource.TestCheckResourceAttr("ansible_group.master", "variables.k3s_role", "server"),
+				),
+			},
+		},
+	})
+}
+
+func TestAnsibleGroup_Children(t *testing.T) {
+	resourceName := "ansible_group.k3s_cluster"
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAnsiblePreCheck(t, resourceName) },
+		ProviderFactories: providerFactories,
+		CheckDestroy:      testAnsibleGroupDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAnsibleGroupChildren(),
+				Check: resource.ComposeTestCheckFunc(
+					testAnsibleGroupExists("ansible_group.k3s_cluster"),
+					resource.TestCheckResourceAttr("ansible_group.k3s_cluster", "name", "k3s_cluster"),
+					resource.TestCheckResourceAttr("ansible_group.k3s_cluster", "children.#", "2"),
+					resource.TestCheckTypeSetElemAttrPair("ansible_group.k3s_cluster", "children.*", "ansible_group.master", "id"),
+					resource.TestCheckTypeSetElemAttrPair("ansible_group.k3s_cluster", "children.*", "ansible_group.node", "id"),
 				),
 			},
 		},
@@ -141,6 +180,42 @@ resource "ansible_group" "master" {
   depends_on = [ansible_inventory.cluster]
   name = "master2"
   inventory = ansible_inventory.cluster.id
+  variables = {
+    k3s_role = "server"
+  }
+}
+`
+}
+
+func testAnsibleGroupChildren() string {
+	return `
+provider "ansible" {
+  path = "/tmp/inventory"
+}
+
+resource "ansible_inventory" "cluster" {
+  group_vars = <<-EOT
+    ---
+    ansible_user: ubuntu
+  EOT
+}
+
+resource "ansible_group" "master" {
+  depends_on = [ansible_inventory.cluster]
+  name = "master"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_group" "node" {
+  depends_on = [ansible_inventory.cluster]
+  name = "node"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_group" "k3s_cluster" {
+  name = "k3s_cluster"
+  inventory = ansible_inventory.cluster.id
+  children = [ansible_group.master.id, ansible_group.node.id]
 }
 `
 }
@@ -2,13 +2,18 @@ package ansible
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
 	"github.com/habakke/terraform-ansible-provider/internal/util"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/rs/zerolog/log"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -18,8 +23,13 @@ func ansibleHostResourceQuery() *schema.Resource {
 		ReadContext:   ansibleHostResourceQueryRead,
 		UpdateContext: ansibleHostResourceQueryUpdate,
 		DeleteContext: ansibleHostResourceQueryDelete,
+		CustomizeDiff: ansibleHostResourceQueryCustomizeDiff,
+		Importer: &schema.ResourceImporter{
+			StateContext: ansibleHostResourceQueryImport,
+		},
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(10 * time.Second),
+			Read:   schema.DefaultTimeout(10 * time.Second),
 			Update: schema.DefaultTimeout(10 * time.Second),
 			Delete: schema.DefaultTimeout(10 * time.Second),
 		},
@@ -36,18 +46,57 @@ func ansibleHostResourceQuery() *schema.Resource {
 			},
 			"group": {
 				Type:         schema.TypeString,
-				Required:     true,
+				Optional:     true,
 				ValidateFunc: validation.NoZeroValues,
+				ExactlyOneOf: []string{"group", "groups"},
+				Deprecated:   "use groups instead",
+				Description:  "ID of the group the host is a member of",
+			},
+			"groups": {
+				Type:         schema.TypeSet,
+				Optional:     true,
+				Computed:     true,
+				MinItems:     1,
+				ExactlyOneOf: []string{"group", "groups"},
+				Description:  "IDs of the groups the host is a member of",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.NoZeroValues,
+				},
 			},
 			"variables": {
-				Type:     schema.TypeMap,
-				Optional: true,
+				Type:             schema.TypeMap,
+				Optional:         true,
+				ConflictsWith:    []string{"variables_json"},
+				ValidateDiagFunc: validateVariablesMap,
 				Elem: &schema.Schema{
 					Type:         schema.TypeString,
 					Required:     true,
 					ValidateFunc: validation.NoZeroValues,
 				},
 			},
+			"variables_json": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"variables"},
+				Description:      "Host variables as a JSON object, keeping numbers, booleans, lists and maps typed",
+				ValidateDiagFunc: validateVariablesJSON,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+				StateFunc: func(v interface{}) string {
+					normalized, _ := structure.NormalizeJsonString(v)
+					return normalized
+				},
+			},
+			"sensitive_variables": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Sensitive:        true,
+				Description:      "Host variables kept out of the plan and logs, encrypted with ansible-vault, which requires a vault password on the provider",
+				ValidateDiagFunc: validateVariablesMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
 		},
 	}
 }
@@ -56,37 +105,58 @@ func ansibleHostResourceQueryCreate(ctx context.Context, d *schema.ResourceData,
 	conf := meta.(providerConfiguration)
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	ctx = sensitiveContext(ctx, d, "sensitive_variables")
 
 	name := util.ResourceToString(d, "name")
-	groupID := util.ResourceToString(d, "group")
+	groupIDs := hostGroupIDs(d)
 	inventoryRef := util.ResourceToString(d, "inventory")
-	variables := util.ResourceToInterfaceMap(d, "variables")
+	variables, err := hostVariables(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
 
-	conf.Mutex.Lock()
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load database")
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
 	}
 
-	g := db.Group(groupID)
-	if g == nil {
-		return diag.Errorf("unable to find group '%s'", groupID)
+	sensitive := util.ResourceToInterfaceMap(d, "sensitive_variables")
+	encrypted, err := encryptVariables(conf, sensitive, nil)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if variables, err = mergeVariables(variables, encrypted); err != nil {
+		return diag.FromErr(err)
 	}
 
 	h := database.NewHost(name, variables)
-	g.UpdateEntity(h)
-	db.UpdateGroup(*g)
+	h.SetSensitiveNames(variableNames(sensitive))
+	logVariables(ctx, "creating host", h.GetID(), h.GetVariables(), h.GetSensitiveNames())
+	for _, groupID := range groupIDs {
+		g := db.Group(groupID)
+		if g == nil {
+			return diag.Errorf("unable to find group '%s'", groupID)
+		}
+		g.UpdateEntity(h)
+		db.UpdateGroup(*g)
+	}
 
 	// Save and export database
-	if err := commitAndExport(db, i.GetInventoryPath()); err != nil {
+	if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
 		return diag.FromErr(err)
 	}
-	conf.Mutex.Unlock()
+	unlock()
 
 	d.SetId(h.GetID())
 	d.MarkNewResource()
@@ -101,30 +171,68 @@ func ansibleHostResourceQueryRead(ctx context.Context, d *schema.ResourceData, m
 
 	inventoryRef := util.ResourceToString(d, "inventory")
 
-	conf.Mutex.Lock()
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutRead))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
+	if !inventory.Exists(conf.Path, inventoryRef) {
+		log.Warn().Str("id", d.Id()).Str("inventory", inventoryRef).Msg("inventory of host no longer exists, removing it from state")
+		d.SetId("")
+		return diags
+	}
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
-	conf.Mutex.Unlock()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
+	unlock()
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load database")
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
 	}
 
 	id := d.Id()
-	g, entry, err := db.FindEntryByID(id)
+	_, entry, err := db.FindEntryByID(id)
 	if err != nil {
-		return diag.Errorf("unable to find entry '%s': %s", id, err.Error())
+		log.Warn().Str("id", id).Msg("host no longer exists, removing it from state")
+		d.SetId("")
+		return diags
+	}
+
+	var groupIDs []string
+	for _, mg := range db.FindGroupsByEntryID(id) {
+		groupIDs = append(groupIDs, mg.GetID())
 	}
+	sort.Strings(groupIDs)
 
 	_ = d.Set("name", entry.GetName())
-	_ = d.Set("group", g.GetID())
+	_ = d.Set("groups", groupIDs)
+	// keep the group in state while it still holds the host, so a host in several groups does not flip between them
+	if groupID := util.ResourceToString(d, "group"); len(groupID) > 0 {
+		if g := db.Group(groupID); g == nil || g.Entry(id) == nil {
+			_ = d.Set("group", groupIDs[0])
+		}
+	}
 
 	h, ok := entry.(*database.Host)
 	if ok {
-		_ = d.Set("variables", h.GetVariables())
+		variables, sensitive, err := splitSensitiveVariables(conf, h.GetVariables(), h.GetSensitiveNames())
+		if err != nil {
+			return diag.Errorf("failed to read variables of host '%s': %s", id, err.Error())
+		}
+		// typed variables, such as those from an imported inventory, only fit in variables_json
+		if _, ok := d.GetOk("variables_json"); ok || hasTypedVariables(variables) {
+			data, err := json.Marshal(variables)
+			if err != nil {
+				return diag.Errorf("failed to encode variables of host '%s': %s", id, err.Error())
+			}
+			_ = d.Set("variables_json", string(data))
+		} else {
+			_ = d.Set("variables", variables)
+		}
+		_ = d.Set("sensitive_variables", sensitive)
 	}
 	return diags
 }
@@ -133,18 +241,27 @@ func ansibleHostResourceQueryUpdate(ctx context.Context, d *schema.ResourceData,
 	conf := meta.(providerConfiguration)
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	ctx = sensitiveContext(ctx, d, "sensitive_variables")
 
 	name := util.ResourceToString(d, "name")
-	groupID := util.ResourceToString(d, "group")
+	groupIDs := hostGroupIDs(d)
 	inventoryRef := util.ResourceToString(d, "inventory")
-	variables := util.ResourceToInterfaceMap(d, "variables")
+	variables, err := hostVariables(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
 
-	conf.Mutex.Lock()
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load database")
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
@@ -155,48 +272,68 @@ func ansibleHostResourceQueryUpdate(ctx context.Context, d *schema.ResourceData,
 		return diag.Errorf("unable to find entry '%s': %s", d.Id(), err.Error())
 	}
 
-	// check if name has changed
+	// check if name has changed, the host is shared between all its groups so it only has to be renamed once
 	if d.HasChange("name") {
 		entry.SetName(name)
 		db.UpdateGroup(*g)
 	}
 
-	// check if group has changed
-	if d.HasChange("group") {
-		// remove host from old group
-		if err := g.RemoveEntity(entry); err != nil {
-			return diag.Errorf("failed remove entry from group '%s': %s", g.GetID(), err.Error())
+	// check if group membership has changed
+	if d.HasChanges("group", "groups") {
+		wanted := make(map[string]bool)
+		for _, groupID := range groupIDs {
+			wanted[groupID] = true
 		}
-		db.UpdateGroup(*g)
 
-		// load new group
-		ng := db.Group(groupID)
-		if ng == nil {
-			return diag.Errorf("failed to locate group '%s': %s", groupID, err.Error())
+		// remove host from old groups
+		for _, og := range db.FindGroupsByEntryID(d.Id()) {
+			if wanted[og.GetID()] {
+				delete(wanted, og.GetID())
+				continue
+			}
+			if err := og.RemoveEntity(entry); err != nil {
+				return diag.Errorf("failed remove entry from group '%s': %s", og.GetID(), err.Error())
+			}
+			db.UpdateGroup(*og)
 		}
 
-		// update name and add entity to new group
-		ng.UpdateEntity(entry)
+		// add host to new groups
+		for groupID := range wanted {
+			ng := db.Group(groupID)
+			if ng == nil {
+				return diag.Errorf("failed to locate group '%s'", groupID)
+			}
+			ng.UpdateEntity(entry)
+			db.UpdateGroup(*ng)
+		}
 	}
 
-	if d.HasChange("variables") {
+	if d.HasChanges("variables", "variables_json", "sensitive_variables") {
 		h, ok := entry.(*database.Host)
 		if ok {
-			for k := range variables {
-				h.SetVariable(k, variables[k])
+			sensitive := util.ResourceToInterfaceMap(d, "sensitive_variables")
+			encrypted, err := encryptVariables(conf, sensitive, h.GetVariables())
+			if err != nil {
+				return diag.FromErr(err)
+			}
+			if variables, err = mergeVariables(variables, encrypted); err != nil {
+				return diag.FromErr(err)
 			}
+			h.SetVariables(variables)
+			h.SetSensitiveNames(variableNames(sensitive))
+			logVariables(ctx, "updating host", h.GetID(), h.GetVariables(), h.GetSensitiveNames())
 		}
 		db.UpdateGroup(*g)
 	}
 
-	if d.HasChanges("name", "group", "variables") {
+	if d.HasChanges("name", "group", "groups", "variables", "variables_json", "sensitive_variables") {
 		// Save and export database
-		if err := commitAndExport(db, i.GetInventoryPath()); err != nil {
+		if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
 			return diag.FromErr(err)
 		}
 	}
 
-	conf.Mutex.Unlock()
+	unlock()
 
 	return ansibleHostResourceQueryRead(ctx, d, meta)
 }
@@ -209,39 +346,137 @@ func ansibleHostResourceQueryDelete(ctx context.Context, d *schema.ResourceData,
 
 	inventoryRef := util.ResourceToString(d, "inventory")
 
-	conf.Mutex.Lock()
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
 	i, err := inventory.Load(conf.Path, inventoryRef)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", inventoryRef, err.Error())
 	}
-	db, err := i.GetAndLoadDatabase()
+	db, err := i.GetAndLoadDatabase(conf.Storage)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load database")
 		return diag.Errorf("failed to load database '%s': %s", inventoryRef, err.Error())
 	}
 
 	id := d.Id()
-	g, entry, err := db.FindEntryByID(id)
+	_, entry, err := db.FindEntryByID(id)
 	if err != nil {
 		log.Error().Err(err).Msg("cannot find host so unable to remove, but continuing anyway")
 	} else {
-		// only remove host from group if we actually find it there. if we dont find it, then everything is ok and we
+		// only remove host from groups if we actually find it there. if we dont find it, then everything is ok and we
 		// can skip the removing it.
 
-		// remove entry from group
-		if err := g.RemoveEntity(entry); err != nil {
-			return diag.Errorf("unable to remove entry from group with id: %s", err.Error())
-		}
+		// remove entry from every group it is a member of
+		for _, g := range db.FindGroupsByEntryID(id) {
+			if err := g.RemoveEntity(entry); err != nil {
+				return diag.Errorf("unable to remove entry from group with id: %s", err.Error())
+			}
 
-		// update group
-		db.UpdateGroup(*g)
+			// update group
+			db.UpdateGroup(*g)
+		}
 	}
 
 	// Save and export database
-	if err := commitAndExport(db, i.GetInventoryPath()); err != nil {
+	if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
 		return diag.FromErr(err)
 	}
-	conf.Mutex.Unlock()
+	unlock()
 
 	return diags
 }
+
+// ansibleHostResourceQueryCustomizeDiff checks that the sensitive variables can be encrypted and exported in every
+// configured format
+func ansibleHostResourceQueryCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	conf := meta.(providerConfiguration)
+	if err := checkSensitiveVariables(d, conf, "sensitive_variables"); err != nil {
+		return err
+	}
+	return checkSensitiveFormats(d, conf)
+}
+
+// ansibleHostResourceQueryImport imports a host by its ID, or by <inventory_id>/<group_name>/<host_name>
+func ansibleHostResourceQueryImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	conf := meta.(providerConfiguration)
+
+	parts := strings.SplitN(d.Id(), "/", 3)
+	if len(parts) != 1 && len(parts) != 3 {
+		return nil, fmt.Errorf("unexpected import ID '%s', expected <host_id> or <inventory_id>/<group_name>/<host_name>", d.Id())
+	}
+	var i *inventory.Inventory
+	var db *database.Database
+	var err error
+	if len(parts) == 3 {
+		i, db, err = loadInventoryDatabase(conf, parts[0], "", d.Timeout(schema.TimeoutRead))
+	} else {
+		i, db, err = findInventoryDatabase(conf, d.Id(), func(db *database.Database) bool {
+			_, _, err := db.FindEntryByID(d.Id())
+			return err == nil
+		}, d.Timeout(schema.TimeoutRead))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry database.Entity
+	if len(parts) == 3 {
+		g, err := db.FindGroupByName(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if entry, err = g.FindEntityByName(parts[2]); err != nil {
+			return nil, err
+		}
+	} else if _, entry, err = db.FindEntryByID(d.Id()); err != nil {
+		return nil, err
+	}
+	if _, ok := entry.(*database.Host); !ok {
+		return nil, fmt.Errorf("'%s' is not a host", d.Id())
+	}
+
+	d.SetId(entry.GetID())
+	_ = d.Set("inventory", i.GetID())
+	return []*schema.ResourceData{d}, nil
+}
+
+// hasTypedVariables checks if any of the variables is not a string
+func hasTypedVariables(variables map[string]interface{}) bool {
+	for _, v := range variables {
+		if _, ok := v.(string); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hostGroupIDs returns the IDs of the groups a host should be a member of, from either the group or groups attribute
+func hostGroupIDs(d *schema.ResourceData) []string {
+	if groupID := util.ResourceToString(d, "group"); len(groupID) > 0 {
+		return []string{groupID}
+	}
+
+	var groupIDs []string
+	if groups, ok := d.Get("groups").(*schema.Set); ok {
+		for _, v := range groups.List() {
+			groupIDs = append(groupIDs, v.(string))
+		}
+	}
+	return groupIDs
+}
+
+// hostVariables returns the variables of a host from either the variables or variables_json attribute
+func hostVariables(d *schema.ResourceData) (map[string]interface{}, error) {
+	if v := util.ResourceToString(d, "variables_json"); len(v) > 0 {
+		variables, err := structure.ExpandJsonFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode variables_json: %s", err.Error())
+		}
+		return variables, nil
+	}
+	return util.ResourceToInterfaceMap(d, "variables"), nil
+}
@@ -64,6 +64,67 @@ func TestAnsibleHost_Update(t *testing.T) {
 	})
 }
 
+func TestAnsibleHost_MultipleGroups(t *testing.T) {
+	resourceName := "ansible_host.k3s-master-1"
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAnsiblePreCheck(t, resourceName) },
+		ProviderFactories: providerFactories,
+		CheckDestroy:      testAnsibleHostDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAnsibleHostMultipleGroups(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("ansible_host.k3s-master-1", "name", "k3s-master-1"),
+					resource.TestCheckResourceAttr("ansible_host.k3s-master-1", "groups.#", "2"),
+					resource.TestCheckTypeSetElemAttrPair("ansible_host.k3s-master-1", "groups.*", "ansible_group.master", "id"),
+					resource.TestCheckTypeSetElemAttrPair("ansible_host.k3s-master-1", "groups.*", "ansible_group.monitoring", "id"),
+					resource.TestCheckResourceAttr("ansible_host.k3s-master-1", "variables.role", "master"),
+				),
+			},
+			{
+				ResourceName:      "ansible_host.k3s-master-1",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "ansible_host.k3s-master-1",
+				ImportState:       true,
+				ImportStateVerify: true,
+				ImportStateIdFunc: testAnsibleHostImportID("ansible_host.k3s-master-1", "master"),
+			},
+		},
+	})
+}
+
+func TestAnsibleHost_VariablesJSON(t *testing.T) {
+	resourceName := "ansible_host.k3s-master-1"
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAnsiblePreCheck(t, resourceName) },
+		ProviderFactories: providerFactories,
+		CheckDestroy:      testAnsibleHostDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAnsibleHostVariablesJSON(),
+				Check: resource.ComposeTestCheckFunc(
+					testAnsibleHostExists("ansible_host.k3s-master-1"),
+					resource.TestCheckResourceAttr("ansible_host.k3s-master-1", "variables_json", `{"ansible_port":22,"enabled":true,"ports":[80,443]}`),
+				),
+			},
+		},
+	})
+}
+
+// testAnsibleHostImportID returns the <inventory_id>/<group_name>/<host_name> import ID of a host
+func testAnsibleHostImportID(resource string, group string) resource.ImportStateIdFunc {
+	return func(s *terraform.State) (string, error) {
+		rs, ok := s.RootModule().Resources[resource]
+		if !ok {
+			return "", fmt.Errorf("not found: %s", resource)
+		}
+		return fmt.Sprintf("%s/%s/%s", rs.Primary.Attributes["inventory"], group, rs.Primary.Attributes["name"]), nil
+	}
+}
+
 func hostExists(hostID string, rootPath string, inventoryRef string, groupID string) bool {
 	i, err := inventory.Load(rootPath, inventoryRef)
 	if err != nil {
@@ -180,6 +241,75 @@ resource "ansible_host" "k3s-master-1" {
 `
 }
 
+func testAnsibleHostMultipleGroups() string {
+	return `
+provider "ansible" {
+  path = "/tmp/inventory"
+}
+
+resource "ansible_inventory" "cluster" {
+  group_vars = <<-EOT
+    ---
+    ansible_user: ubuntu
+  EOT
+}
+
+resource "ansible_group" "master" {
+  depends_on = [ansible_inventory.cluster]
+  name = "master"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_group" "monitoring" {
+  depends_on = [ansible_inventory.cluster]
+  name = "monitoring"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_host" "k3s-master-1" {
+  name = "k3s-master-1"
+  inventory = ansible_inventory.cluster.id
+  groups = [ansible_group.master.id, ansible_group.monitoring.id]
+  variables = {
+    role = "master"
+  }
+}
+`
+}
+
+func testAnsibleHostVariablesJSON() string {
+	return `
+provider "ansible" {
+  path = "/tmp/inventory"
+}
+
+resource "ansible_inventory" "cluster" {
+  group_vars = <<-EOT
+    ---
+    ansible_user: ubuntu
+  EOT
+}
+
+resource "ansible_group" "master" {
+  depends_on = [ansible_inventory.cluster]
+  name = "master"
+  inventory = ansible_inventory.cluster.id
+}
+
+resource "ansible_host" "k3s-master-1" {
+  depends_on = [ansible_group.master]
+  name = "k3s-master-1"
+  inventory = ansible_inventory.cluster.id
+  group = ansible_group.master.id
+  variables_json = jsonencode({
+    ansible_port = 22
+    enabled      = true
+    ports        = [80, 443]
+  })
+}
+`
+}
+
 func testAnsibleHostExists(resource string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
 		rs, ok := state.RootModule().Resources[resource]
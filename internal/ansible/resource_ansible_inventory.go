@@ -2,12 +2,20 @@ package ansible
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
 	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
 	"github.com/habakke/terraform-ansible-provider/internal/util"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -17,18 +25,95 @@ func ansibleInventoryResourceQuery() *schema.Resource {
 		ReadContext:   ansibleInventoryResourceQueryRead,
 		UpdateContext: ansibleInventoryResourceQueryUpdate,
 		DeleteContext: ansibleInventoryResourceQueryDelete,
+		CustomizeDiff: ansibleInventoryResourceQueryCustomizeDiff,
+		Importer: &schema.ResourceImporter{
+			StateContext: ansibleInventoryResourceQueryImport,
+		},
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(10 * time.Second),
+			Read:   schema.DefaultTimeout(10 * time.Second),
 			Update: schema.DefaultTimeout(10 * time.Second),
 			Delete: schema.DefaultTimeout(10 * time.Second),
 		},
 		Schema: map[string]*schema.Schema{
-			"group_vars": {
+			"name": {
 				Type:         schema.TypeString,
-				Required:     true,
-				DefaultFunc:  schema.EnvDefaultFunc("GROUP_VARS", nil),
-				Description:  "Ansible inventory group vars",
-				ValidateFunc: validation.NoZeroValues,
+				Optional:     true,
+				ForceNew:     true,
+				Description:  "Name of the inventory, which is kept in a subdirectory of the provider path with the same name. Without a name the inventory is kept in the provider path itself.",
+				ValidateFunc: validateInventoryName,
+			},
+			"group_vars": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("GROUP_VARS", nil),
+				ConflictsWith: []string{"group_vars_json"},
+				Description:   "Ansible inventory group vars, written to group_vars/all/all.yml",
+				ValidateDiagFunc: validation.AllDiag(
+					validation.ToDiagFunc(validation.NoZeroValues),
+					validateYAML,
+				),
+			},
+			"group_vars_json": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"group_vars"},
+				Description:      "Ansible inventory group vars as a JSON object, encoded to YAML in group_vars/all/all.yml",
+				ValidateFunc:     validateJSONObject,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+				StateFunc: func(v interface{}) string {
+					normalized, _ := structure.NormalizeJsonString(v)
+					return normalized
+				},
+			},
+			"group_vars_files": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Description:      "Additional group vars files by their path relative to group_vars, such as all/main.yml. Files in group_vars/all which are not declared are removed.",
+				ValidateDiagFunc: validateGroupVarsFiles,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"strict_group_vars": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Reject group vars which are not a mapping of variables, or which set Ansible magic variables such as inventory_hostname and groups",
+			},
+			"sensitive_group_vars": {
+				Type:             schema.TypeMap,
+				Optional:         true,
+				Sensitive:        true,
+				Description:      "Group vars kept out of the plan and logs, written to group_vars/all/sensitive.yml encrypted with ansible-vault, which requires a vault password on the provider",
+				ValidateDiagFunc: validateVariablesMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"exported_files": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "SHA-256 checksums of the exported inventory files, used to detect files edited outside of terraform",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"rendered_ini": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The inventory rendered as hosts.ini, with host variables inline except vault encrypted variables",
+			},
+			"rendered_yaml": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The inventory rendered as hosts.yml, with host variables inline",
+			},
+			"rendered_json": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The inventory rendered as dynamic inventory JSON",
 			},
 		},
 	}
@@ -39,15 +124,33 @@ func ansibleInventoryResourceQueryCreate(ctx context.Context, d *schema.Resource
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	groupVars := util.ResourceToString(d, "group_vars")
+	ctx = sensitiveContext(ctx, d, "sensitive_group_vars")
+
+	sensitive := util.ResourceToInterfaceMap(d, "sensitive_group_vars")
+
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutCreate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
+	name := util.ResourceToString(d, "name")
+	path := inventoryPath(conf, name)
+	if len(name) > 0 && inventory.IsInventory(path) {
+		return diag.Errorf("an inventory named '%s' already exists at '%s'", name, path)
+	}
 
-	conf.Mutex.Lock()
-	i := inventory.NewInventory(conf.Path)
+	i := inventory.NewInventory(path)
 	log.Debug().Str("id", i.GetID()).Msg("created new inventory")
-	if err := i.Commit(groupVars); err != nil {
+	logVariables(ctx, "committing sensitive group vars", i.GetID(), sensitive, variableNames(sensitive))
+	files, err := groupVarsFiles(conf, d, &i)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if err := i.CommitGroupVarsFiles(files); err != nil {
 		return diag.Errorf("failed to commit inventory: %s", err.Error())
 	}
-	conf.Mutex.Unlock()
+	unlock()
 
 	d.SetId(i.GetID())
 	d.MarkNewResource()
@@ -62,18 +165,62 @@ func ansibleInventoryResourceQueryRead(ctx context.Context, d *schema.ResourceDa
 
 	id := d.Id()
 
-	conf.Mutex.Lock()
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutRead))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
+	if !inventory.Exists(conf.Path, id) {
+		log.Warn().Str("id", id).Msg("inventory no longer exists, removing it from state")
+		d.SetId("")
+		return diags
+	}
 	i, err := inventory.Load(conf.Path, id)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", id, err.Error())
 	}
-	groupVars, err := i.Load()
+	// removed files show up as a change to the group vars attributes, which writes them again
+	files, err := i.LoadGroupVarsFiles()
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", id, err.Error())
 	}
-	conf.Mutex.Unlock()
+	groupVars := string(files[inventory.GroupVarsFileName])
+	groupVarsJSON := ""
+	if _, ok := d.GetOk("group_vars_json"); ok && len(groupVars) > 0 {
+		if groupVarsJSON, err = yamlToJSON(groupVars); err != nil {
+			return diag.Errorf("failed to decode group vars of inventory '%s': %s", id, err.Error())
+		}
+		groupVars = ""
+	}
+	stored, err := loadSensitiveGroupVars(i)
+	if err != nil {
+		return diag.Errorf("failed to load inventory '%s': %s", id, err.Error())
+	}
+	_, sensitive, err := splitSensitiveVariables(conf, stored, variableNames(stored))
+	if err != nil {
+		return diag.Errorf("failed to read sensitive group vars of inventory '%s': %s", id, err.Error())
+	}
+	db, err := i.GetAndLoadDatabase(conf.Storage)
+	if err != nil {
+		return diag.Errorf("failed to load database '%s': %s", id, err.Error())
+	}
+	expected, err := expectedExports(db, conf)
+	if err != nil {
+		return diag.Errorf("failed to render inventory '%s': %s", id, err.Error())
+	}
+	exported := actualExports(i.GetInventoryPath(), expected)
+	unlock()
 
+	_ = d.Set("name", inventoryName(conf, i))
 	_ = d.Set("group_vars", groupVars)
+	_ = d.Set("group_vars_json", groupVarsJSON)
+	_ = d.Set("group_vars_files", additionalGroupVarsFiles(files))
+	_ = d.Set("sensitive_group_vars", sensitive)
+	_ = d.Set("exported_files", exported)
+	if err := setRenderedInventory(d, db); err != nil {
+		return diag.FromErr(err)
+	}
 
 	return diags
 }
@@ -83,24 +230,85 @@ func ansibleInventoryResourceQueryUpdate(ctx context.Context, d *schema.Resource
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	ctx = sensitiveContext(ctx, d, "sensitive_group_vars")
+
 	id := d.Id()
-	groupVars := util.ResourceToString(d, "group_vars")
+	sensitive := util.ResourceToInterfaceMap(d, "sensitive_group_vars")
+
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutUpdate))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
 
 	i, err := inventory.Load(conf.Path, id)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", id, err.Error())
 	}
-	if d.HasChange("group_vars") {
-		conf.Mutex.Lock()
-		if err := i.Commit(groupVars); err != nil {
+	if d.HasChanges("group_vars", "group_vars_json", "group_vars_files", "sensitive_group_vars") {
+		logVariables(ctx, "updating sensitive group vars", id, sensitive, variableNames(sensitive))
+		files, err := groupVarsFiles(conf, d, i)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if err := i.CommitGroupVarsFiles(files); err != nil {
 			return diag.Errorf("failed to update inventory: %s", err.Error())
 		}
-		conf.Mutex.Unlock()
 	}
+	if d.HasChange("exported_files") {
+		// the exported files no longer match the database, so they are exported again
+		db, err := i.GetAndLoadDatabase(conf.Storage)
+		if err != nil {
+			return diag.Errorf("failed to load database '%s': %s", id, err.Error())
+		}
+		if err := commitAndExport(db, i.GetInventoryPath(), conf); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	unlock()
 
 	return ansibleInventoryResourceQueryRead(ctx, d, meta)
 }
 
+// diffLockTimeout is how long planning waits for the inventory lock, as a diff has no configurable timeouts
+const diffLockTimeout = 10 * time.Second
+
+// ansibleInventoryResourceQueryCustomizeDiff plans an update when the exported files found on disk no longer match
+// what the database renders, for example after hosts.ini was edited by hand
+func ansibleInventoryResourceQueryCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	conf := meta.(providerConfiguration)
+	if err := checkStrictGroupVars(d); err != nil {
+		return err
+	}
+	if err := checkSensitiveVariables(d, conf, "sensitive_group_vars"); err != nil {
+		return err
+	}
+	if len(d.Id()) == 0 || !inventory.Exists(conf.Path, d.Id()) {
+		return nil
+	}
+
+	_, db, err := loadInventoryDatabase(conf, d.Id(), "", diffLockTimeout)
+	if err != nil {
+		return err
+	}
+	expected, err := expectedExports(db, conf)
+	if err != nil {
+		return fmt.Errorf("failed to render inventory '%s': %s", d.Id(), err.Error())
+	}
+
+	exported := make(map[string]string)
+	if m, ok := d.Get("exported_files").(map[string]interface{}); ok {
+		for k, v := range m {
+			exported[k] = v.(string)
+		}
+	}
+	if !reflect.DeepEqual(expected, exported) {
+		log.Warn().Str("id", d.Id()).Msg("exported inventory files do not match the database")
+		return d.SetNew("exported_files", expected)
+	}
+	return nil
+}
+
 func ansibleInventoryResourceQueryDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 	conf := meta.(providerConfiguration)
@@ -109,7 +317,12 @@ func ansibleInventoryResourceQueryDelete(ctx context.Context, d *schema.Resource
 
 	id := d.Id()
 
-	conf.Mutex.Lock()
+	unlock, err := lockInventory(conf, d.Timeout(schema.TimeoutDelete))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	defer unlock()
+
 	i, err := inventory.Load(conf.Path, id)
 	if err != nil {
 		return diag.Errorf("failed to load inventory '%s': %s", id, err.Error())
@@ -117,6 +330,144 @@ func ansibleInventoryResourceQueryDelete(ctx context.Context, d *schema.Resource
 	if err := i.Delete(); err != nil {
 		return diag.Errorf("failed to delete inventory: %s", err.Error())
 	}
-	conf.Mutex.Unlock()
+	unlock()
 	return diags
 }
+
+func ansibleInventoryResourceQueryImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	conf := meta.(providerConfiguration)
+
+	if _, _, err := loadInventoryDatabase(conf, d.Id(), "", d.Timeout(schema.TimeoutRead)); err != nil {
+		return nil, err
+	}
+	return []*schema.ResourceData{d}, nil
+}
+
+// renderedInventory lists the rendered_* attributes and the encoder producing each of them
+var renderedInventory = map[string]func(*database.Database, EncoderOptions) ([]byte, error){
+	"rendered_ini":  encodeINI,
+	"rendered_yaml": encodeYAML,
+	"rendered_json": encodeJSON,
+}
+
+// setRenderedInventory sets the rendered_* attributes. Host variables are always rendered inline, as host_vars
+// files are not available where the rendered inventory is used, except encrypted variables in rendered_ini.
+func setRenderedInventory(d *schema.ResourceData, db *database.Database) error {
+	for k, encode := range renderedInventory {
+		data, err := encode(db, EncoderOptions{OmitEncrypted: k == "rendered_ini"})
+		if err != nil {
+			return fmt.Errorf("failed to render inventory: %s", err.Error())
+		}
+		_ = d.Set(k, string(data))
+	}
+	return nil
+}
+
+// checkStrictGroupVars checks the group vars of an inventory with strict_group_vars set when the plan is made, as
+// the checks span several attributes. Values which are only known after apply are not checked.
+func checkStrictGroupVars(d *schema.ResourceDiff) error {
+	if strict, _ := d.Get("strict_group_vars").(bool); !strict {
+		return nil
+	}
+
+	documents := make(map[string]string)
+	for _, k := range []string{"group_vars", "group_vars_json"} {
+		if v, _ := d.Get(k).(string); d.NewValueKnown(k) && len(v) > 0 {
+			documents[k] = v
+		}
+	}
+	if files, ok := d.Get("group_vars_files").(map[string]interface{}); ok && d.NewValueKnown("group_vars_files") {
+		for k, v := range files {
+			if isGroupVarsDocument(k, fmt.Sprint(v)) {
+				documents[fmt.Sprintf("group_vars_files[%q]", k)] = fmt.Sprint(v)
+			}
+		}
+	}
+	names := make([]string, 0, len(documents))
+	for name := range documents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []string
+	for _, name := range names {
+		for _, err := range checkGroupVars(documents[name]) {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err.Error()))
+		}
+	}
+	if sensitive, ok := d.Get("sensitive_group_vars").(map[string]interface{}); ok && d.NewValueKnown("sensitive_group_vars") {
+		for _, k := range variableNames(sensitive) {
+			if ansibleMagicVariables[k] {
+				errs = append(errs, fmt.Sprintf("sensitive_group_vars: '%s' is an Ansible magic variable and cannot be set as a group var", k))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid group vars:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// groupVarsFilesPrefix is the folder of the keys of group_vars_files, relative to the group_vars folder
+const groupVarsFilesPrefix = "all/"
+
+// groupVarsFiles returns every file the inventory declares in the group_vars folder of the all group, by file name
+func groupVarsFiles(conf providerConfiguration, d *schema.ResourceData, i *inventory.Inventory) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if v := util.ResourceToString(d, "group_vars_json"); len(v) > 0 {
+		vars, err := structure.ExpandJsonFromString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode group_vars_json: %s", err.Error())
+		}
+		data, err := yaml.Marshal(vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode group_vars_json: %s", err.Error())
+		}
+		files[inventory.GroupVarsFileName] = append([]byte("---\n"), data...)
+	} else if v := util.ResourceToString(d, "group_vars"); len(v) > 0 {
+		files[inventory.GroupVarsFileName] = []byte(v)
+	}
+
+	for k, v := range util.ResourceToInterfaceMap(d, "group_vars_files") {
+		files[strings.TrimPrefix(k, groupVarsFilesPrefix)] = []byte(fmt.Sprint(v))
+	}
+
+	if sensitive := util.ResourceToInterfaceMap(d, "sensitive_group_vars"); len(sensitive) > 0 {
+		current, err := loadSensitiveGroupVars(i)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encodeSensitiveGroupVars(conf, sensitive, current)
+		if err != nil {
+			return nil, err
+		}
+		files[sensitiveGroupVarsFile] = data
+	}
+	return files, nil
+}
+
+// additionalGroupVarsFiles returns the files in the group_vars folder of the all group which are not written from
+// the group_vars or sensitive_group_vars attributes, by their path relative to the group_vars folder
+func additionalGroupVarsFiles(files map[string][]byte) map[string]interface{} {
+	additional := make(map[string]interface{})
+	for name, data := range files {
+		if name == inventory.GroupVarsFileName || name == sensitiveGroupVarsFile {
+			continue
+		}
+		additional[groupVarsFilesPrefix+name] = string(data)
+	}
+	return additional
+}
+
+// yamlToJSON converts a YAML document of variables to a JSON object
+func yamlToJSON(document string) (string, error) {
+	vars := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(document), &vars); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -39,8 +39,15 @@ func TestAnsibleInventory_Basic(t *testing.T) {
 					testAnsibleInventoryExists("ansible_inventory.cluster"),
 					resource.TestCheckResourceAttrSet("ansible_inventory.cluster", "id"),
 					resource.TestCheckResourceAttr("ansible_inventory.cluster", "group_vars", TestGroupVarsData),
+					resource.TestCheckResourceAttr("ansible_inventory.cluster", "rendered_ini", ""),
+					resource.TestCheckResourceAttrSet("ansible_inventory.cluster", "rendered_json"),
 				),
 			},
+			{
+				ResourceName:      "ansible_inventory.cluster",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
 		},
 	})
 }
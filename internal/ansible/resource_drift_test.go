@@ -0,0 +1,134 @@
+package ansible
+
+import (
+	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+const DriftPath = "/tmp/drift"
+
+func TestExportDrift(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(DriftPath, os.ModePerm))
+	defer os.RemoveAll(DriftPath)
+
+	db := database.NewDatabase(DriftPath)
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("k3s-master-1", map[string]interface{}{"ansible_user": "root"}))
+	_ = db.AddGroup(*master)
+
+	conf := providerConfiguration{Path: DriftPath, Formats: []string{"ini", "yaml"}, HostVarsFiles: true, Mutex: &sync.Mutex{}}
+	expected, err := expectedExports(db, conf)
+	assert.NoError(t, err)
+	assert.Empty(t, expected, "nothing is exported before the database is committed")
+
+	assert.NoError(t, commitAndExport(db, DriftPath, conf))
+	expected, err = expectedExports(db, conf)
+	assert.NoError(t, err)
+	assert.Len(t, expected, 3)
+	assert.Contains(t, expected, "hosts.ini")
+	assert.Contains(t, expected, "hosts.yml")
+	assert.Contains(t, expected, "host_vars/k3s-master-1.yml")
+	assert.Equal(t, expected, actualExports(DriftPath, expected))
+
+	// edited and removed files no longer match
+	assert.NoError(t, os.WriteFile(filepath.Join(DriftPath, "hosts.ini"), []byte("[master]\nedited\n"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(DriftPath, "host_vars", "k3s-master-1.yml")))
+	actual := actualExports(DriftPath, expected)
+	assert.NotEqual(t, expected["hosts.ini"], actual["hosts.ini"])
+	assert.Equal(t, expected["hosts.yml"], actual["hosts.yml"])
+	assert.NotContains(t, actual, "host_vars/k3s-master-1.yml")
+
+	assert.NoError(t, commitAndExport(db, DriftPath, conf))
+	assert.Equal(t, expected, actualExports(DriftPath, expected))
+}
+
+func TestReadRemovedEntities(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(DriftPath, os.ModePerm))
+	defer os.RemoveAll(DriftPath)
+
+	i := inventory.NewInventory(DriftPath)
+	assert.NoError(t, i.Commit("---\n"))
+	db := database.NewDatabase(DriftPath)
+	master := database.NewGroup("master")
+	host := database.NewHost("k3s-master-1", nil)
+	_ = master.AddEntity(host)
+	_ = db.AddGroup(*master)
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: DriftPath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+
+	d := ansibleGroupResourceQuery().TestResourceData()
+	d.SetId(master.GetID())
+	_ = d.Set("inventory", i.GetID())
+	assert.False(t, ansibleGroupResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Equal(t, master.GetID(), d.Id())
+
+	d = ansibleHostResourceQuery().TestResourceData()
+	d.SetId("unknown")
+	_ = d.Set("inventory", i.GetID())
+	assert.False(t, ansibleHostResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Empty(t, d.Id(), "a removed host is planned for re-creation")
+
+	assert.NoError(t, db.RemoveGroup(*master))
+	assert.NoError(t, db.Commit())
+	d = ansibleGroupResourceQuery().TestResourceData()
+	d.SetId(master.GetID())
+	_ = d.Set("inventory", i.GetID())
+	assert.False(t, ansibleGroupResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Empty(t, d.Id(), "a removed group is planned for re-creation")
+
+	assert.NoError(t, os.Remove(filepath.Join(DriftPath, "id")))
+	d = ansibleInventoryResourceQuery().TestResourceData()
+	d.SetId(i.GetID())
+	assert.False(t, ansibleInventoryResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Empty(t, d.Id(), "a removed inventory is planned for re-creation")
+}
+
+func TestReadHostGroup(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(DriftPath, os.ModePerm))
+	defer os.RemoveAll(DriftPath)
+
+	i := inventory.NewInventory(DriftPath)
+	assert.NoError(t, i.Commit("---\n"))
+	db := database.NewDatabase(DriftPath)
+	host := database.NewHost("k3s-node-1", nil)
+	var groups []*database.Group
+	for _, name := range []string{"node", "zone_a", "zone_b", "zone_c"} {
+		g := database.NewGroup(name)
+		_ = g.AddEntity(host)
+		_ = db.AddGroup(*g)
+		groups = append(groups, g)
+	}
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: DriftPath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+
+	// the group in state is kept while it holds the host, although the host is found in every group
+	d := ansibleHostResourceQuery().TestResourceData()
+	d.SetId(host.GetID())
+	_ = d.Set("inventory", i.GetID())
+	_ = d.Set("group", groups[2].GetID())
+	for n := 0; n < 10; n++ {
+		assert.False(t, ansibleHostResourceQueryRead(context.Background(), d, conf).HasError())
+		assert.Equal(t, groups[2].GetID(), d.Get("group"))
+	}
+
+	// a host removed from the group in state gets the remaining group with the lowest ID
+	_ = groups[2].RemoveEntity(host)
+	db.UpdateGroup(*groups[2])
+	assert.NoError(t, db.Commit())
+	var remaining []string
+	for _, g := range []*database.Group{groups[0], groups[1], groups[3]} {
+		remaining = append(remaining, g.GetID())
+	}
+	sort.Strings(remaining)
+	assert.False(t, ansibleHostResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Equal(t, remaining[0], d.Get("group"))
+}
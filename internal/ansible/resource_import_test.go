@@ -0,0 +1,123 @@
+package ansible
+
+import (
+	"context"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const ImportPath = "/tmp/import"
+
+func TestImport(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(ImportPath, os.ModePerm))
+	defer os.RemoveAll(ImportPath)
+
+	i := inventory.NewInventory(ImportPath)
+	assert.NoError(t, i.Commit("---\n"))
+	db := database.NewDatabase(ImportPath)
+	master := database.NewGroup("master")
+	host := database.NewHost("k3s-master-1", nil)
+	_ = master.AddEntity(host)
+	_ = db.AddGroup(*master)
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: ImportPath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+	importID := func(r *schema.Resource, id string) (*schema.ResourceData, error) {
+		d := r.TestResourceData()
+		d.SetId(id)
+		result, err := r.Importer.StateContext(context.Background(), d, conf)
+		if err != nil {
+			return nil, err
+		}
+		return result[0], nil
+	}
+
+	d, err := importID(ansibleInventoryResourceQuery(), i.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, i.GetID(), d.Id())
+	_, err = importID(ansibleInventoryResourceQuery(), "unknown")
+	assert.Error(t, err)
+
+	for _, id := range []string{master.GetID(), fmt.Sprintf("%s/master", i.GetID())} {
+		d, err := importID(ansibleGroupResourceQuery(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, master.GetID(), d.Id())
+		assert.Equal(t, i.GetID(), d.Get("inventory"))
+	}
+	_, err = importID(ansibleGroupResourceQuery(), fmt.Sprintf("%s/unknown", i.GetID()))
+	assert.Error(t, err)
+
+	for _, id := range []string{host.GetID(), fmt.Sprintf("%s/master/k3s-master-1", i.GetID())} {
+		d, err := importID(ansibleHostResourceQuery(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, host.GetID(), d.Id())
+		assert.Equal(t, i.GetID(), d.Get("inventory"))
+	}
+	_, err = importID(ansibleHostResourceQuery(), master.GetID())
+	assert.Error(t, err)
+	_, err = importID(ansibleHostResourceQuery(), fmt.Sprintf("%s/master", i.GetID()))
+	assert.Error(t, err)
+}
+
+func TestImportNamedInventories(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(ImportPath, os.ModePerm))
+	defer os.RemoveAll(ImportPath)
+
+	// an inventory at the provider path and two named inventories, each with a group and a host
+	inventories := make(map[string]inventory.Inventory)
+	groups := make(map[string]*database.Group)
+	hosts := make(map[string]*database.Host)
+	for _, name := range []string{"", "staging", "production"} {
+		path := filepath.Join(ImportPath, name)
+		i := inventory.NewInventory(path)
+		assert.NoError(t, i.Commit("---\n"))
+		db := database.NewDatabase(path)
+		master := database.NewGroup("master")
+		host := database.NewHost("k3s-master-1", nil)
+		_ = master.AddEntity(host)
+		_ = db.AddGroup(*master)
+		assert.NoError(t, db.Commit())
+		inventories[name], groups[name], hosts[name] = i, master, host
+	}
+
+	conf := providerConfiguration{Path: ImportPath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+	importID := func(r *schema.Resource, id string) (*schema.ResourceData, error) {
+		d := r.TestResourceData()
+		d.SetId(id)
+		result, err := r.Importer.StateContext(context.Background(), d, conf)
+		if err != nil {
+			return nil, err
+		}
+		return result[0], nil
+	}
+
+	// a bare ID is found in whichever inventory holds it
+	for name, i := range inventories {
+		for _, id := range []string{groups[name].GetID(), fmt.Sprintf("%s/master", i.GetID())} {
+			d, err := importID(ansibleGroupResourceQuery(), id)
+			assert.NoError(t, err)
+			assert.Equal(t, groups[name].GetID(), d.Id())
+			assert.Equal(t, i.GetID(), d.Get("inventory"))
+		}
+		for _, id := range []string{hosts[name].GetID(), fmt.Sprintf("%s/master/k3s-master-1", i.GetID())} {
+			d, err := importID(ansibleHostResourceQuery(), id)
+			assert.NoError(t, err)
+			assert.Equal(t, hosts[name].GetID(), d.Id())
+			assert.Equal(t, i.GetID(), d.Get("inventory"))
+		}
+	}
+
+	_, err := importID(ansibleGroupResourceQuery(), "unknown")
+	assert.Error(t, err)
+	_, err = importID(ansibleHostResourceQuery(), "unknown")
+	assert.Error(t, err)
+	_, err = importID(ansibleHostResourceQuery(), groups["staging"].GetID())
+	assert.Error(t, err)
+}
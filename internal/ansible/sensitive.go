@@ -0,0 +1,210 @@
+package ansible
+
+import (
+	"context"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/vault"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	"sort"
+)
+
+// sensitiveGroupVarsFile is the file in group_vars/all holding the sensitive_group_vars of an inventory, which
+// Ansible merges with the other files in the folder
+const sensitiveGroupVarsFile = "sensitive.yml"
+
+// encryptVariables encrypts sensitive variables with the vault password of the provider. Values which did not change
+// keep their current encryption, so applying the same configuration again does not rewrite the inventory.
+func encryptVariables(conf providerConfiguration, sensitive map[string]interface{}, current map[string]interface{}) (map[string]interface{}, error) {
+	encrypted := make(map[string]interface{}, len(sensitive))
+	if len(sensitive) > 0 && len(conf.VaultPassword) == 0 {
+		return nil, fmt.Errorf("sensitive variables are only stored encrypted, but no vault password is set on the provider")
+	}
+
+	for k, v := range sensitive {
+		plaintext := fmt.Sprint(v)
+		if vaulttext, ok := vault.FromValue(current[k]); ok {
+			if data, err := vault.Decrypt(vaulttext, conf.VaultPassword); err == nil && string(data) == plaintext {
+				encrypted[k] = current[k]
+				continue
+			}
+		}
+
+		vaulttext, err := vault.Encrypt([]byte(plaintext), conf.VaultPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt variable '%s': %s", k, err.Error())
+		}
+		encrypted[k] = vault.NewValue(vaulttext)
+	}
+	return encrypted, nil
+}
+
+// checkSensitiveVariables rejects sensitive variables when the plan is made if the provider has no vault password to
+// encrypt them with. Values which are only known after apply are not checked.
+func checkSensitiveVariables(d *schema.ResourceDiff, conf providerConfiguration, key string) error {
+	if sensitive, _ := d.Get(key).(map[string]interface{}); len(sensitive) == 0 || len(conf.VaultPassword) > 0 {
+		return nil
+	}
+	return fmt.Errorf("%s requires vault_password or vault_password_file on the provider, as sensitive values are only stored encrypted", key)
+}
+
+// checkSensitiveFormats rejects sensitive variables when the plan is made if they would be written inline to an INI
+// inventory, which cannot hold encrypted values. Values which are only known after apply are not checked.
+func checkSensitiveFormats(d *schema.ResourceDiff, conf providerConfiguration) error {
+	if conf.HostVarsFiles {
+		return nil
+	}
+	if sensitive, _ := d.Get("sensitive_variables").(map[string]interface{}); len(sensitive) == 0 {
+		return nil
+	}
+	for _, f := range conf.Formats {
+		if f == "ini" {
+			return fmt.Errorf("sensitive_variables cannot be written to an INI inventory, as it cannot hold vault encrypted values, set host_vars_files on the provider or use the yaml or json format")
+		}
+	}
+	return nil
+}
+
+// splitSensitiveVariables splits stored variables into the plain variables and the decrypted sensitive variables,
+// where sensitive variables are either encrypted or have one of the given names
+func splitSensitiveVariables(conf providerConfiguration, variables map[string]interface{}, names []string) (map[string]interface{}, map[string]interface{}, error) {
+	marked := make(map[string]bool, len(names))
+	for _, n := range names {
+		marked[n] = true
+	}
+
+	plain := make(map[string]interface{})
+	sensitive := make(map[string]interface{})
+	for k, v := range variables {
+		vaulttext, ok := vault.FromValue(v)
+		if !ok {
+			if marked[k] {
+				sensitive[k] = fmt.Sprint(v)
+			} else {
+				plain[k] = v
+			}
+			continue
+		}
+		if len(conf.VaultPassword) == 0 {
+			return nil, nil, fmt.Errorf("variable '%s' is encrypted, but no vault password is set on the provider", k)
+		}
+		data, err := vault.Decrypt(vaulttext, conf.VaultPassword)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt variable '%s': %s", k, err.Error())
+		}
+		sensitive[k] = string(data)
+	}
+	util.RegisterSecrets(secretValues(sensitive)...)
+	return plain, sensitive, nil
+}
+
+// mergeVariables adds the encrypted sensitive variables to the plain variables, where a variable cannot be both
+func mergeVariables(variables map[string]interface{}, encrypted map[string]interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(variables)+len(encrypted))
+	for k, v := range variables {
+		merged[k] = v
+	}
+	for k, v := range encrypted {
+		if _, ok := merged[k]; ok {
+			return nil, fmt.Errorf("variable '%s' cannot be both a variable and a sensitive variable", k)
+		}
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// variableNames returns the sorted names of the variables
+func variableNames(variables map[string]interface{}) []string {
+	names := make([]string, 0, len(variables))
+	for k := range variables {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secretValues returns the values of sensitive variables as they could show up in log output
+func secretValues(sensitive map[string]interface{}) []string {
+	values := make([]string, 0, len(sensitive))
+	for _, v := range sensitive {
+		values = append(values, fmt.Sprint(v))
+	}
+	return values
+}
+
+// sensitiveContext registers the values of the sensitive attributes of a resource, so they are redacted from the
+// zerolog output and masked in the tflog output of the returned context
+func sensitiveContext(ctx context.Context, d *schema.ResourceData, keys ...string) context.Context {
+	for _, k := range keys {
+		util.RegisterSecrets(secretValues(util.ResourceToInterfaceMap(d, k))...)
+	}
+	return util.MaskSecrets(ctx)
+}
+
+// logVariables logs the variables of a resource at debug level, with the values of the sensitive variables redacted
+func logVariables(ctx context.Context, msg string, id string, variables map[string]interface{}, sensitive []string) {
+	redacted := util.RedactVariables(variables, sensitive)
+	log.Debug().Str("id", id).Interface("variables", redacted).Msg(msg)
+	tflog.Debug(ctx, msg, map[string]interface{}{"id": id, "variables": redacted})
+}
+
+// encodeSensitiveGroupVars encodes sensitive group vars as the YAML document of the sensitiveGroupVarsFile, where the
+// values are written as !vault tagged strings
+func encodeSensitiveGroupVars(conf providerConfiguration, sensitive map[string]interface{}, current map[string]interface{}) ([]byte, error) {
+	encrypted, err := encryptVariables(conf, sensitive, current)
+	if err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(yamlVariables(encrypted))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sensitive group vars: %s", err.Error())
+	}
+	return append([]byte("---\n"), data...), nil
+}
+
+// decodeSensitiveGroupVars decodes the YAML document of the sensitiveGroupVarsFile into its variables as stored, with
+// !vault tagged strings as encrypted values
+func decodeSensitiveGroupVars(data []byte) (map[string]interface{}, error) {
+	variables := make(map[string]interface{})
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode sensitive group vars: %s", err.Error())
+	}
+	if len(doc.Content) == 0 {
+		return variables, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to decode sensitive group vars: expected a mapping at line %d", root.Line)
+	}
+	for n := 0; n+1 < len(root.Content); n += 2 {
+		k, v := root.Content[n], root.Content[n+1]
+		if v.Tag == "!vault" {
+			variables[k.Value] = vault.NewValue(v.Value)
+			continue
+		}
+		var value interface{}
+		if err := v.Decode(&value); err != nil {
+			return nil, fmt.Errorf("failed to decode sensitive group var '%s': %s", k.Value, err.Error())
+		}
+		variables[k.Value] = value
+	}
+	return variables, nil
+}
+
+// loadSensitiveGroupVars loads the variables of the sensitiveGroupVarsFile of an inventory as stored
+func loadSensitiveGroupVars(i *inventory.Inventory) (map[string]interface{}, error) {
+	data, err := i.LoadGroupVarsFile(sensitiveGroupVarsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sensitive group vars: %s", err.Error())
+	}
+	if data == nil {
+		return map[string]interface{}{}, nil
+	}
+	return decodeSensitiveGroupVars(data)
+}
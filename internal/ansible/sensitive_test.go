@@ -0,0 +1,284 @@
+package ansible
+
+import (
+	"context"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/vault"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const SensitivePath = "/tmp/sensitive"
+
+func TestSensitiveVariables(t *testing.T) {
+	conf := providerConfiguration{VaultPassword: "password"}
+
+	encrypted, err := encryptVariables(conf, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, nil)
+	assert.NoError(t, err)
+	vaulttext, ok := vault.FromValue(encrypted["ansible_become_pass"])
+	assert.True(t, ok)
+
+	// unchanged values keep their encryption, changed values are encrypted again
+	again, err := encryptVariables(conf, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, encrypted, again)
+	changed, err := encryptVariables(conf, map[string]interface{}{"ansible_become_pass": "changed"}, encrypted)
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, changed)
+
+	merged, err := mergeVariables(map[string]interface{}{"ansible_user": "root"}, encrypted)
+	assert.NoError(t, err)
+	_, err = mergeVariables(map[string]interface{}{"ansible_become_pass": "plain"}, encrypted)
+	assert.Error(t, err)
+
+	plain, sensitive, err := splitSensitiveVariables(conf, merged, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ansible_user": "root"}, plain)
+	assert.Equal(t, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, sensitive)
+
+	// without a password sensitive variables are not stored, but plain text values stored by earlier versions are
+	// still known as sensitive by their name
+	_, err = encryptVariables(providerConfiguration{}, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, nil)
+	assert.Error(t, err)
+	unencrypted, err := encryptVariables(providerConfiguration{}, map[string]interface{}{}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, unencrypted)
+	plain, sensitive, err = splitSensitiveVariables(providerConfiguration{}, map[string]interface{}{"ansible_user": "root", "ansible_become_pass": "s3cr3t"}, []string{"ansible_become_pass"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ansible_user": "root"}, plain)
+	assert.Equal(t, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, sensitive)
+
+	// without the right password nothing encrypted is decrypted
+	_, _, err = splitSensitiveVariables(providerConfiguration{}, merged, nil)
+	assert.Error(t, err)
+	_, _, err = splitSensitiveVariables(providerConfiguration{VaultPassword: "wrong"}, merged, nil)
+	assert.Error(t, err)
+
+	// encrypted values are written as !vault tagged strings to YAML, and as Ansible reads them from JSON
+	db := database.NewDatabase(SensitivePath)
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("k3s-master-1", merged))
+	_ = db.AddGroup(*master)
+
+	data, err := encodeYAML(db, EncoderOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ansible_become_pass: !vault |\n")
+	assert.NotContains(t, string(data), "s3cr3t")
+	var node yaml.Node
+	assert.NoError(t, yaml.Unmarshal(data, &node))
+
+	hostVars, err := encodeHostVars(db.SortedGroups()[0].GetHosts()[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(hostVars), "ansible_become_pass: !vault |\n")
+	assert.Contains(t, string(hostVars), strings.Split(vaulttext, "\n")[1])
+
+	data, err = encodeJSON(db, EncoderOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"__ansible_vault"`)
+
+	_, err = encodeINI(db, EncoderOptions{})
+	assert.Error(t, err)
+	_, err = encodeINI(db, EncoderOptions{HostVarsFiles: true})
+	assert.NoError(t, err)
+	data, err = encodeINI(db, EncoderOptions{OmitEncrypted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "[master]\nk3s-master-1 ansible_user=root\n\n", string(data))
+}
+
+func TestHostSensitiveVariables(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(SensitivePath, os.ModePerm))
+	defer os.RemoveAll(SensitivePath)
+
+	i := inventory.NewInventory(SensitivePath)
+	assert.NoError(t, i.Commit("---\n"))
+	db := database.NewDatabase(SensitivePath)
+	master := database.NewGroup("master")
+	_ = db.AddGroup(*master)
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: SensitivePath, Formats: []string{"yaml"}, VaultPassword: "password", Mutex: &sync.Mutex{}}
+	r := ansibleHostResourceQuery()
+	d := r.TestResourceData()
+	_ = d.Set("name", "k3s-master-1")
+	_ = d.Set("inventory", i.GetID())
+	_ = d.Set("groups", []interface{}{master.GetID()})
+	_ = d.Set("variables", map[string]interface{}{"ansible_user": "root"})
+	_ = d.Set("sensitive_variables", map[string]interface{}{"ansible_become_pass": "s3cr3t"})
+	assert.False(t, ansibleHostResourceQueryCreate(context.Background(), d, conf).HasError())
+	assert.Equal(t, map[string]interface{}{"ansible_user": "root"}, d.Get("variables"))
+	assert.Equal(t, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, d.Get("sensitive_variables"))
+
+	// the secret is kept encrypted at rest and in the exported inventory
+	for _, f := range []string{db.Path(), SensitivePath + "/hosts.yml"} {
+		data, err := os.ReadFile(f)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "s3cr3t")
+		assert.Contains(t, string(data), "$ANSIBLE_VAULT;1.1;AES256")
+	}
+
+	// the inventory can still be read, where rendered_ini leaves out the encrypted variable
+	inv := ansibleInventoryResourceQuery().TestResourceData()
+	inv.SetId(i.GetID())
+	assert.False(t, ansibleInventoryResourceQueryRead(context.Background(), inv, conf).HasError())
+	assert.Equal(t, "[master]\nk3s-master-1 ansible_user=root\n\n", inv.Get("rendered_ini"))
+	assert.Contains(t, inv.Get("rendered_yaml"), "ansible_become_pass: !vault |\n")
+	ds := ansibleInventoryDataSource().TestResourceData()
+	_ = ds.Set("id", i.GetID())
+	assert.False(t, ansibleInventoryDataSourceRead(context.Background(), ds, conf).HasError())
+	assert.Equal(t, inv.Get("rendered_ini"), ds.Get("rendered_ini"))
+
+	// the data sources redact the values of sensitive variables
+	expected := `{"ansible_become_pass":"` + util.Redacted + `","ansible_user":"root"}`
+	assert.Equal(t, expected, ds.Get("groups.0.hosts.0.variables_json"))
+	hosts := ansibleHostsDataSource().TestResourceData()
+	_ = hosts.Set("inventory", i.GetID())
+	assert.False(t, ansibleHostsDataSourceRead(context.Background(), hosts, conf).HasError())
+	assert.Equal(t, expected, hosts.Get("hosts.0.variables_json"))
+
+	d2 := r.TestResourceData()
+	d2.SetId(d.Id())
+	_ = d2.Set("inventory", i.GetID())
+	assert.True(t, ansibleHostResourceQueryRead(context.Background(), d2, providerConfiguration{Path: SensitivePath, Mutex: &sync.Mutex{}}).HasError())
+}
+
+func TestHostSensitiveVariablesINI(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(SensitivePath, os.ModePerm))
+	defer os.RemoveAll(SensitivePath)
+
+	i := inventory.NewInventory(SensitivePath)
+	assert.NoError(t, i.Commit("---\n"))
+	db := database.NewDatabase(SensitivePath)
+	master := database.NewGroup("master")
+	_ = db.AddGroup(*master)
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: SensitivePath, Formats: []string{"ini"}, VaultPassword: "password", Mutex: &sync.Mutex{}}
+	r := ansibleHostResourceQuery()
+	raw := map[string]interface{}{
+		"name":                "k3s-master-1",
+		"inventory":           i.GetID(),
+		"groups":              []interface{}{master.GetID()},
+		"sensitive_variables": map[string]interface{}{"ansible_become_pass": "s3cr3t"},
+	}
+
+	// encrypted values cannot be written inline to hosts.ini, which is caught when the plan is made
+	_, err := r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), conf)
+	assert.Error(t, err)
+	for _, c := range []providerConfiguration{
+		{Path: SensitivePath, Formats: []string{"ini"}, VaultPassword: "password", HostVarsFiles: true},
+		{Path: SensitivePath, Formats: []string{"yaml"}, VaultPassword: "password"},
+	} {
+		_, err = r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), c)
+		assert.NoError(t, err)
+	}
+
+	// a host which cannot be exported is not saved to the database
+	before, err := os.ReadFile(db.Path())
+	assert.NoError(t, err)
+	d := r.TestResourceData()
+	_ = d.Set("name", "k3s-master-1")
+	_ = d.Set("inventory", i.GetID())
+	_ = d.Set("groups", []interface{}{master.GetID()})
+	_ = d.Set("sensitive_variables", map[string]interface{}{"ansible_become_pass": "s3cr3t"})
+	assert.True(t, ansibleHostResourceQueryCreate(context.Background(), d, conf).HasError())
+	after, err := os.ReadFile(db.Path())
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	conf.HostVarsFiles = true
+	assert.False(t, ansibleHostResourceQueryCreate(context.Background(), d, conf).HasError())
+}
+
+func TestHostSensitiveVariablesWithoutVault(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(SensitivePath, os.ModePerm))
+	defer os.RemoveAll(SensitivePath)
+
+	i := inventory.NewInventory(SensitivePath)
+	assert.NoError(t, i.Commit("---\n"))
+	db := database.NewDatabase(SensitivePath)
+	master := database.NewGroup("master")
+	_ = db.AddGroup(*master)
+	assert.NoError(t, db.Commit())
+
+	conf := providerConfiguration{Path: SensitivePath, Formats: []string{"yaml"}, Mutex: &sync.Mutex{}}
+	r := ansibleHostResourceQuery()
+	raw := map[string]interface{}{
+		"name":                "k3s-master-1",
+		"inventory":           i.GetID(),
+		"groups":              []interface{}{master.GetID()},
+		"sensitive_variables": map[string]interface{}{"ansible_become_pass": "s3cr3t"},
+	}
+	_, err := r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), conf)
+	assert.Error(t, err)
+
+	// sensitive variables are never stored in plain text
+	d := r.TestResourceData()
+	_ = d.Set("name", "k3s-master-1")
+	_ = d.Set("inventory", i.GetID())
+	_ = d.Set("groups", []interface{}{master.GetID()})
+	_ = d.Set("variables", map[string]interface{}{"ansible_user": "root"})
+	_ = d.Set("sensitive_variables", map[string]interface{}{"ansible_become_pass": "s3cr3t"})
+	assert.True(t, ansibleHostResourceQueryCreate(context.Background(), d, conf).HasError())
+	for _, f := range []string{db.Path(), SensitivePath + "/hosts.yml"} {
+		data, _ := os.ReadFile(f)
+		assert.NotContains(t, string(data), "s3cr3t")
+	}
+}
+
+func TestInventorySensitiveGroupVars(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(SensitivePath, os.ModePerm))
+	defer os.RemoveAll(SensitivePath)
+
+	file := SensitivePath + "/group_vars/all/" + sensitiveGroupVarsFile
+	r := ansibleInventoryResourceQuery()
+	raw := map[string]interface{}{"sensitive_group_vars": map[string]interface{}{"ansible_become_pass": "s3cr3t"}}
+
+	// without a vault password sensitive group vars are rejected, and never written in plain text
+	conf := providerConfiguration{Path: SensitivePath, Formats: []string{"ini"}, Mutex: &sync.Mutex{}}
+	_, err := r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), conf)
+	assert.Error(t, err)
+	d := r.TestResourceData()
+	_ = d.Set("sensitive_group_vars", map[string]interface{}{"ansible_become_pass": "s3cr3t"})
+	assert.True(t, ansibleInventoryResourceQueryCreate(context.Background(), d, conf).HasError())
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	conf.VaultPassword = "password"
+	_, err = r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), conf)
+	assert.NoError(t, err)
+	d = r.TestResourceData()
+	_ = d.Set("group_vars", "---\nansible_user: root\n")
+	_ = d.Set("sensitive_group_vars", map[string]interface{}{"ansible_become_pass": "s3cr3t"})
+	assert.False(t, ansibleInventoryResourceQueryCreate(context.Background(), d, conf).HasError())
+	assert.Equal(t, map[string]interface{}{"ansible_become_pass": "s3cr3t"}, d.Get("sensitive_group_vars"))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ansible_become_pass: !vault |\n")
+	assert.NotContains(t, string(data), "s3cr3t")
+
+	// the encryption is kept when nothing changed, and the file is removed when there are no sensitive group vars
+	before := d.Get("sensitive_group_vars")
+	assert.False(t, ansibleInventoryResourceQueryRead(context.Background(), d, conf).HasError())
+	assert.Equal(t, before, d.Get("sensitive_group_vars"))
+	again, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	loaded, err := inventory.Load(SensitivePath, d.Id())
+	assert.NoError(t, err)
+	_ = d.Set("sensitive_group_vars", map[string]interface{}{})
+	files, err := groupVarsFiles(conf, d, loaded)
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.CommitGroupVarsFiles(files))
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	assert.False(t, ansibleInventoryResourceQueryDelete(context.Background(), d, conf).HasError())
+}
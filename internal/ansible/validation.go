@@ -0,0 +1,278 @@
+package ansible
+
+import (
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/vault"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ansibleIdentifier matches the variable names accepted by Ansible
+var ansibleIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// groupVarsFileKey matches the keys of group_vars_files, which are files in the group_vars folder of the all group
+var groupVarsFileKey = regexp.MustCompile(`^all/[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+
+// inventoryNamePattern matches the names of inventories, which are used as a directory name in the provider path
+var inventoryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+
+// reservedInventoryNames are directories used by the inventory in the provider path itself
+var reservedInventoryNames = map[string]bool{"group_vars": true, "host_vars": true}
+
+// ansibleMagicVariables are set by Ansible itself, so group vars with these names are ignored or break playbooks
+var ansibleMagicVariables = map[string]bool{
+	"ansible_check_mode": true, "ansible_collection_name": true, "ansible_config_file": true,
+	"ansible_dependent_role_names": true, "ansible_diff_mode": true, "ansible_facts": true, "ansible_forks": true,
+	"ansible_index_var": true, "ansible_inventory_sources": true, "ansible_limit": true, "ansible_local": true,
+	"ansible_loop": true, "ansible_loop_var": true, "ansible_parent_role_names": true,
+	"ansible_parent_role_paths": true, "ansible_play_batch": true, "ansible_play_hosts": true,
+	"ansible_play_hosts_all": true, "ansible_play_name": true, "ansible_play_role_names": true,
+	"ansible_playbook_python": true, "ansible_role_name": true, "ansible_role_names": true, "ansible_run_tags": true,
+	"ansible_search_path": true, "ansible_skip_tags": true, "ansible_verbosity": true, "ansible_version": true,
+	"group_names": true, "groups": true, "hostvars": true, "inventory_dir": true, "inventory_file": true,
+	"inventory_hostname": true, "inventory_hostname_short": true, "omit": true, "play_hosts": true,
+	"playbook_dir": true, "role_name": true, "role_names": true, "role_path": true,
+}
+
+// pythonKeywords are not valid variable names in Ansible, even if they are identifiers
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true, "async": true,
+	"await": true, "break": true, "class": true, "continue": true, "def": true, "del": true, "elif": true,
+	"else": true, "except": true, "finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+	"pass": true, "raise": true, "return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// validateJSONObject validates that a string attribute contains a JSON object
+func validateJSONObject(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+
+	if _, err := structure.ExpandJsonFromString(v); err != nil {
+		return nil, []error{fmt.Errorf("%q contains an invalid JSON object: %s", k, err.Error())}
+	}
+	return nil, nil
+}
+
+// validateVariableName validates that a variable name is a valid Ansible identifier
+func validateVariableName(name string) error {
+	if !ansibleIdentifier.MatchString(name) {
+		return fmt.Errorf("'%s' is not a valid Ansible variable name, it must start with a letter or underscore and only contain letters, digits and underscores", name)
+	}
+	if pythonKeywords[name] {
+		return fmt.Errorf("'%s' is a Python keyword and cannot be used as an Ansible variable name", name)
+	}
+	return nil
+}
+
+// validateVariables validates the names of the variables, and that every value can be written to an INI inventory
+func validateVariables(vars map[string]interface{}, path func(string) cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	for k, v := range vars {
+		if err := validateVariableName(k); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid variable name",
+				Detail:        err.Error(),
+				AttributePath: path(k),
+			})
+			continue
+		}
+		if _, err := encodeValue(v); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       "Invalid variable value",
+				Detail:        fmt.Sprintf("the value of '%s' cannot be written to an INI inventory: %s", k, err.Error()),
+				AttributePath: path(k),
+			})
+		}
+	}
+	return diags
+}
+
+// validateVariablesMap validates a map attribute of variables
+func validateVariablesMap(i interface{}, path cty.Path) diag.Diagnostics {
+	vars, ok := i.(map[string]interface{})
+	if !ok {
+		return diag.Errorf("expected type of variables to be a map")
+	}
+	return validateVariables(vars, func(k string) cty.Path {
+		return path.IndexString(k)
+	})
+}
+
+// validateVariablesJSON validates a JSON object attribute of variables
+func validateVariablesJSON(i interface{}, path cty.Path) diag.Diagnostics {
+	if diags := validation.ToDiagFunc(validateJSONObject)(i, path); diags.HasError() {
+		return diags
+	}
+
+	vars, _ := structure.ExpandJsonFromString(i.(string))
+	return validateVariables(vars, func(string) cty.Path {
+		return path
+	})
+}
+
+// validateGroupVarsFiles validates the keys of the group_vars_files attribute
+func validateGroupVarsFiles(i interface{}, path cty.Path) diag.Diagnostics {
+	files, ok := i.(map[string]interface{})
+	if !ok {
+		return diag.Errorf("expected type of group_vars_files to be a map")
+	}
+
+	var diags diag.Diagnostics
+	for k := range files {
+		var detail string
+		switch {
+		case !groupVarsFileKey.MatchString(k):
+			detail = fmt.Sprintf("'%s' is not a file in the all folder of group_vars, such as all/main.yml", k)
+		case k == groupVarsFilesPrefix+inventory.GroupVarsFileName:
+			detail = fmt.Sprintf("'%s' is written from group_vars or group_vars_json", k)
+		case k == groupVarsFilesPrefix+sensitiveGroupVarsFile:
+			detail = fmt.Sprintf("'%s' is written from sensitive_group_vars", k)
+		default:
+			if v, ok := files[k].(string); ok && isGroupVarsDocument(k, v) {
+				diags = append(diags, validateYAML(v, path.IndexString(k))...)
+			}
+			continue
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Invalid group vars file",
+			Detail:        detail,
+			AttributePath: path.IndexString(k),
+		})
+	}
+	return diags
+}
+
+// isGroupVarsDocument checks if Ansible reads a group vars file as a YAML document, which excludes files encrypted
+// as a whole with ansible-vault and files with an extension Ansible ignores
+func isGroupVarsDocument(name string, content string) bool {
+	switch filepath.Ext(name) {
+	case "", ".yml", ".yaml", ".json":
+		return !vault.IsEncrypted(content)
+	}
+	return false
+}
+
+// yamlErrorLine matches the line the parser reports for a syntax error
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// parseYAML parses a YAML document and returns its root node, or nil for an empty document
+func parseYAML(document string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(document), &doc); err != nil {
+		line, column := syntaxErrorPosition(document, err)
+		msg := strings.TrimPrefix(yamlErrorLine.ReplaceAllString(err.Error(), ""), "yaml: ")
+		return nil, fmt.Errorf("line %d, column %d: %s", line, column, msg)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// maxSyntaxErrorSearch limits how far past the reported line a syntax error is searched for, as every step parses the
+// document up to that point again
+const maxSyntaxErrorSearch = 4096
+
+// syntaxErrorPosition returns the line and column of a syntax error in a YAML document. The parser only reports a
+// line, which is where the enclosing node starts rather than where parsing failed, so the position is found as the
+// end of the shortest part of the document, from the start of that line, which fails with the same error. When it
+// is not found the start of the reported line is returned.
+func syntaxErrorPosition(document string, err error) (int, int) {
+	start := 0
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		for n := 1; n < line && start < len(document); n++ {
+			next := strings.IndexByte(document[start:], '\n')
+			if next < 0 {
+				break
+			}
+			start += next + 1
+		}
+	}
+
+	end := start
+	for n := start; n < len(document) && n < start+maxSyntaxErrorSearch; {
+		_, size := utf8.DecodeRuneInString(document[n:])
+		var doc yaml.Node
+		if perr := yaml.Unmarshal([]byte(document[:n+size]), &doc); perr != nil && perr.Error() == err.Error() {
+			end = n
+			break
+		}
+		n += size
+	}
+
+	before := document[:end]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// validateYAML validates that a string attribute contains a YAML document
+func validateYAML(i interface{}, path cty.Path) diag.Diagnostics {
+	v, ok := i.(string)
+	if !ok {
+		return diag.Errorf("expected type of group vars to be string")
+	}
+	if _, err := parseYAML(v); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid YAML",
+			Detail:        err.Error(),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// checkGroupVars checks that a YAML document of group vars is a mapping of variables, which does not set any of the
+// Ansible magic variables
+func checkGroupVars(document string) []error {
+	root, err := parseYAML(document)
+	if err != nil {
+		return []error{err}
+	}
+	if root == nil {
+		return nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return []error{fmt.Errorf("line %d, column %d: group vars must be a mapping of variable names to values", root.Line, root.Column)}
+	}
+
+	var errs []error
+	for n := 0; n+1 < len(root.Content); n += 2 {
+		k := root.Content[n]
+		if ansibleMagicVariables[k.Value] {
+			errs = append(errs, fmt.Errorf("line %d, column %d: '%s' is an Ansible magic variable and cannot be set as a group var", k.Line, k.Column, k.Value))
+		}
+	}
+	return errs
+}
+
+// validateInventoryName validates that the name of an inventory can be used as a directory in the provider path
+func validateInventoryName(i interface{}, k string) ([]string, []error) {
+	v, ok := i.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", k)}
+	}
+	if !inventoryNamePattern.MatchString(v) {
+		return nil, []error{fmt.Errorf("%q must start with a letter, digit or underscore and only contain letters, digits, dots, dashes and underscores, got '%s'", k, v)}
+	}
+	if reservedInventoryNames[v] {
+		return nil, []error{fmt.Errorf("%q cannot be '%s', as it is used by the inventory in the provider path", k, v)}
+	}
+	return nil, nil
+}
@@ -0,0 +1,84 @@
+package ansible
+
+import (
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateVariableName(t *testing.T) {
+	assert.NoError(t, validateVariableName("ansible_host"))
+	assert.NoError(t, validateVariableName("_private"))
+	assert.Error(t, validateVariableName("1st"))
+	assert.Error(t, validateVariableName("with-dash"))
+	assert.Error(t, validateVariableName("with space"))
+	assert.Error(t, validateVariableName("class"))
+}
+
+func TestValidateVariables(t *testing.T) {
+	path := cty.GetAttrPath("variables")
+
+	assert.False(t, validateVariablesMap(map[string]interface{}{"motd": "welcome = home"}, path).HasError())
+
+	diags := validateVariablesMap(map[string]interface{}{"bad-name": "value"}, path)
+	assert.True(t, diags.HasError())
+	assert.Equal(t, path.IndexString("bad-name"), diags[0].AttributePath)
+
+	assert.True(t, validateVariablesMap(map[string]interface{}{"motd": "\xff"}, path).HasError())
+	assert.True(t, validateVariablesJSON(`{"not valid": 1}`, path).HasError())
+	assert.True(t, validateVariablesJSON(`[1]`, path).HasError())
+	assert.False(t, validateVariablesJSON(`{"ports": [80, 443]}`, path).HasError())
+}
+
+func TestValidateYAML(t *testing.T) {
+	path := cty.GetAttrPath("group_vars")
+
+	assert.False(t, validateYAML(TestGroupVarsData, path).HasError())
+	assert.False(t, validateYAML("---\n", path).HasError())
+	assert.False(t, validateYAML("---\npassword: !vault |\n  $ANSIBLE_VAULT;1.1;AES256\n  6162\n", path).HasError())
+
+	diags := validateYAML("---\nansible_user: ubuntu\nk3s_version: v1: v2\n", path)
+	assert.True(t, diags.HasError())
+	assert.Equal(t, "line 3, column 16: mapping values are not allowed in this context", diags[0].Detail)
+	assert.Equal(t, path, diags[0].AttributePath)
+
+	files := map[string]interface{}{"all/main.yml": "---\nkey: [\n", "all/README.md": "key: [\n", "all/vault.yml": "$ANSIBLE_VAULT;1.1;AES256\n6162\n"}
+	diags = validateGroupVarsFiles(files, cty.GetAttrPath("group_vars_files"))
+	assert.Len(t, diags, 1)
+	assert.Equal(t, cty.GetAttrPath("group_vars_files").IndexString("all/main.yml"), diags[0].AttributePath)
+}
+
+func TestCheckGroupVars(t *testing.T) {
+	assert.Empty(t, checkGroupVars(TestGroupVarsData))
+	assert.Empty(t, checkGroupVars(""))
+
+	errs := checkGroupVars("---\n- ansible_user\n")
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "line 2, column 1: group vars must be a mapping")
+
+	errs = checkGroupVars("---\nansible_user: ubuntu\ninventory_hostname: master\ngroups: []\n")
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Error(), "line 3, column 1: 'inventory_hostname' is an Ansible magic variable")
+	assert.Contains(t, errs[1].Error(), "line 4, column 1: 'groups'")
+
+	// the column points at the offending node, also when it does not start the line
+	errs = checkGroupVars("---\n  - ansible_user\n")
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "line 2, column 3: group vars must be a mapping")
+	errs = checkGroupVars("---\n{ansible_user: ubuntu, inventory_hostname: master}\n")
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "line 2, column 24: 'inventory_hostname' is an Ansible magic variable")
+
+	// syntax errors are reported where parsing failed, counting the column in characters
+	for document, expected := range map[string]string{
+		"---\nansible_user: ubuntu\nk3s_version: v1: v2\n": "line 3, column 16: mapping values are not allowed in this context",
+		"---\nmotd: \"héllo\"\nk: ü: v\n":                  "line 3, column 5: mapping values are not allowed in this context",
+		"---\nk3s:\n\t- server\n":                          "line 3, column 1: found character that cannot start any token",
+		"---\nports: [80, 443\n":                           "line 2, column 9: did not find expected ',' or ']'",
+	} {
+		errs = checkGroupVars(document)
+		if assert.Len(t, errs, 1) {
+			assert.Equal(t, expected, errs[0].Error())
+		}
+	}
+}
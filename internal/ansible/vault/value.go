@@ -0,0 +1,24 @@
+package vault
+
+// jsonKey is how Ansible represents an encrypted value in JSON, such as the output of a dynamic inventory
+const jsonKey = "__ansible_vault"
+
+// NewValue returns an encrypted value in the form it is stored in host variables. The database keeps it as is, the
+// JSON inventory writes it the way Ansible reads encrypted values from JSON, and the YAML inventory writes it as a
+// !vault tagged string.
+func NewValue(vaulttext string) map[string]interface{} {
+	return map[string]interface{}{jsonKey: vaulttext}
+}
+
+// FromValue returns the encrypted value of a variable created by NewValue
+func FromValue(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	s, ok := m[jsonKey].(string)
+	if !ok || !IsEncrypted(s) {
+		return "", false
+	}
+	return s, true
+}
@@ -0,0 +1,137 @@
+// Package vault encrypts and decrypts values in the AES256 format of ansible-vault, so encrypted values written by the
+// provider can be decrypted natively by Ansible
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"strings"
+)
+
+const (
+	// header starts every encrypted value
+	header = "$ANSIBLE_VAULT"
+	// cipherName is the only cipher supported by current versions of ansible-vault
+	cipherName = "AES256"
+	// iterations is the number of PBKDF2 iterations used by ansible-vault
+	iterations = 10000
+	// lineLength is the width ansible-vault wraps the encrypted value at
+	lineLength = 80
+)
+
+// IsEncrypted checks if the value is encrypted with ansible-vault
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), header+";")
+}
+
+// deriveKeys derives the AES key, the HMAC key and the counter IV from the password the way ansible-vault does
+func deriveKeys(password string, salt []byte) ([]byte, []byte, []byte) {
+	derived := pbkdf2.Key([]byte(password), salt, iterations, 2*32+aes.BlockSize, sha256.New)
+	return derived[:32], derived[32:64], derived[64:]
+}
+
+// Encrypt encrypts plaintext with the password, returning the value as written by ansible-vault encrypt_string
+func Encrypt(plaintext []byte, password string) (string, error) {
+	if len(password) == 0 {
+		return "", fmt.Errorf("vault password is empty")
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %s", err.Error())
+	}
+	key, hmacKey, iv := deriveKeys(password, salt)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, padded)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(ciphertext)
+
+	inner := strings.Join([]string{
+		hex.EncodeToString(salt),
+		hex.EncodeToString(mac.Sum(nil)),
+		hex.EncodeToString(ciphertext),
+	}, "\n")
+	body := hex.EncodeToString([]byte(inner))
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%s;1.1;%s\n", header, cipherName))
+	for i := 0; i < len(body); i += lineLength {
+		end := i + lineLength
+		if end > len(body) {
+			end = len(body)
+		}
+		b.WriteString(body[i:end])
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt or by ansible-vault, including values with a vault ID label
+func Decrypt(vaulttext string, password string) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(vaulttext), "\n")
+	fields := strings.Split(strings.TrimSpace(lines[0]), ";")
+	if len(fields) < 3 || fields[0] != header {
+		return nil, fmt.Errorf("value is not encrypted with ansible-vault")
+	}
+	if fields[2] != cipherName {
+		return nil, fmt.Errorf("unsupported vault cipher '%s'", fields[2])
+	}
+
+	var body strings.Builder
+	for _, l := range lines[1:] {
+		body.WriteString(strings.TrimSpace(l))
+	}
+	inner, err := hex.DecodeString(body.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault data: %s", err.Error())
+	}
+	parts := strings.Split(string(inner), "\n")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid vault data: expected salt, hmac and ciphertext")
+	}
+	var decoded [3][]byte
+	for i, p := range parts {
+		if decoded[i], err = hex.DecodeString(p); err != nil {
+			return nil, fmt.Errorf("invalid vault data: %s", err.Error())
+		}
+	}
+	salt, expectedMAC, ciphertext := decoded[0], decoded[1], decoded[2]
+
+	key, hmacKey, iv := deriveKeys(password, salt)
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return nil, fmt.Errorf("failed to decrypt vault value, the vault password is incorrect or the value is corrupt")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padded := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(padded, ciphertext)
+	if len(padded) == 0 {
+		return nil, fmt.Errorf("invalid vault data: ciphertext is empty")
+	}
+	padding := int(padded[len(padded)-1])
+	if padding < 1 || padding > aes.BlockSize || padding > len(padded) ||
+		!bytes.Equal(padded[len(padded)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("invalid vault data: bad padding")
+	}
+	return padded[:len(padded)-padding], nil
+}
@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, plaintext := range []string{"", "s3cr3t", "exactly 16 bytes", strings.Repeat("long secret ", 20), "ünïcödé"} {
+		vaulttext, err := Encrypt([]byte(plaintext), "password")
+		assert.NoError(t, err)
+		assert.True(t, IsEncrypted(vaulttext))
+		assert.True(t, strings.HasPrefix(vaulttext, "$ANSIBLE_VAULT;1.1;AES256\n"))
+		assert.True(t, strings.HasSuffix(vaulttext, "\n"))
+		for _, l := range strings.Split(strings.TrimSpace(vaulttext), "\n")[1:] {
+			assert.LessOrEqual(t, len(l), 80)
+		}
+
+		decrypted, err := Decrypt(vaulttext, "password")
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, string(decrypted))
+	}
+
+	// the salt is random, so the same value never encrypts the same way twice
+	a, _ := Encrypt([]byte("s3cr3t"), "password")
+	b, _ := Encrypt([]byte("s3cr3t"), "password")
+	assert.NotEqual(t, a, b)
+
+	_, err := Encrypt([]byte("s3cr3t"), "")
+	assert.Error(t, err)
+}
+
+func TestDecryptErrors(t *testing.T) {
+	vaulttext, err := Encrypt([]byte("s3cr3t"), "password")
+	assert.NoError(t, err)
+
+	_, err = Decrypt(vaulttext, "wrong")
+	assert.Error(t, err)
+
+	// a vault ID label and indentation, as in a !vault tagged YAML string, are accepted
+	lines := strings.Split(strings.TrimSpace(vaulttext), "\n")
+	lines[0] = "$ANSIBLE_VAULT;1.2;AES256;prod"
+	decrypted, err := Decrypt("  "+strings.Join(lines, "\n  "), "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", string(decrypted))
+
+	tampered := []byte(vaulttext)
+	tampered[len(tampered)-2] ^= 1
+	_, err = Decrypt(string(tampered), "password")
+	assert.Error(t, err)
+
+	for _, v := range []string{"s3cr3t", "$ANSIBLE_VAULT;1.1;AES128\n00", "$ANSIBLE_VAULT;1.1;AES256\nzz", "$ANSIBLE_VAULT;1.1;AES256\n00"} {
+		_, err := Decrypt(v, "password")
+		assert.Error(t, err, v)
+	}
+}
+
+func TestValue(t *testing.T) {
+	vaulttext, err := Encrypt([]byte("s3cr3t"), "password")
+	assert.NoError(t, err)
+
+	v, ok := FromValue(NewValue(vaulttext))
+	assert.True(t, ok)
+	assert.Equal(t, vaulttext, v)
+
+	for _, v := range []interface{}{vaulttext, map[string]interface{}{"__ansible_vault": "plain"}, map[string]interface{}{"__ansible_vault": vaulttext, "other": 1}, nil} {
+		_, ok := FromValue(v)
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a file so that readers, and the file after a crash, see either the old or the new
+// content in full. The data is written to a temporary file in the same folder, synced to disk and renamed over the
+// target. As with os.WriteFile, perm is subject to the umask.
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(file)
+
+	name := filepath.Join(dir, fmt.Sprintf(".%s.%d.%d.tmp", filepath.Base(file), os.Getpid(), rand.Int63()))
+	tmp, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	// the temporary file is only left behind if something fails before the rename
+	defer func() {
+		if tmp != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	tmp = nil
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes a folder to disk so a rename in it survives a crash. Not all platforms support syncing a folder,
+// so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
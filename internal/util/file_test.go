@@ -0,0 +1,35 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const AtomicPath = "/tmp/atomic_test"
+
+func TestWriteFileAtomic(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(AtomicPath, os.ModePerm))
+	defer os.RemoveAll(AtomicPath)
+
+	file := filepath.Join(AtomicPath, "hosts.ini")
+	assert.NoError(t, WriteFileAtomic(file, []byte("[master]\n"), 0640))
+	assert.NoError(t, WriteFileAtomic(file, []byte("[node]\n"), 0640))
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "[node]\n", string(data))
+
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(AtomicPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(entries))
+
+	// writing into a missing folder fails without creating the file
+	assert.Error(t, WriteFileAtomic(filepath.Join(AtomicPath, "missing", "hosts.ini"), []byte{}, 0640))
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockRetryInterval is how long to wait between attempts to acquire a FileLock held by another process
+const lockRetryInterval = 50 * time.Millisecond
+
+// FileLock is an advisory lock on a file, used to serialize access to a resource between processes
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+// NewFileLock returns a new FileLock using the lock file at the given path
+func NewFileLock(path string) *FileLock {
+	return &FileLock{
+		path: path,
+	}
+}
+
+// Path to the lock file
+func (s *FileLock) Path() string {
+	return s.path
+}
+
+// Lock acquires an exclusive lock, waiting up to timeout for the lock to be released by another process
+func (s *FileLock) Lock(timeout time.Duration) error {
+	if s.file != nil {
+		return fmt.Errorf("lock '%s' is already held", s.path)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file '%s': %s", s.path, err.Error())
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to lock '%s': %s", s.path, err.Error())
+		}
+		if ok {
+			s.file = f
+			return nil
+		}
+		if time.Now().After(deadline) {
+			_ = f.Close()
+			return fmt.Errorf("timed out after %s waiting for lock '%s'", timeout, s.path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Unlock releases the lock
+func (s *FileLock) Unlock() error {
+	if s.file == nil {
+		return nil
+	}
+
+	err := unlockFile(s.file)
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to unlock '%s': %s", s.path, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+const LockFile = "/tmp/filelock_test.lock"
+
+func TestFileLock(t *testing.T) {
+	defer os.Remove(LockFile)
+
+	l1 := NewFileLock(LockFile)
+	assert.NoError(t, l1.Lock(time.Second))
+
+	// flock locks belong to the open file description, so a second handle in the same process contends like
+	// another process would
+	l2 := NewFileLock(LockFile)
+	assert.Error(t, l2.Lock(200*time.Millisecond))
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, l1.Unlock())
+		close(released)
+	}()
+	assert.NoError(t, l2.Lock(2*time.Second))
+	<-released
+	assert.NoError(t, l2.Unlock())
+	assert.NoError(t, l2.Unlock())
+}
@@ -9,8 +9,7 @@ import (
 	"time"
 )
 
-//nolint:deadcode,may be used later
-//lint:file-ignore U1000 May be used later
+// GetEnv returns the value of an environment variable, or fallback when it is not set
 func GetEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -25,9 +24,9 @@ func ConfigureLogging(logLevel string, logCaller bool) {
 	}
 	zerolog.SetGlobalLevel(l)
 	if logCaller {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}).With().Caller().Logger()
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: redactWriter{out: os.Stdout}, TimeFormat: time.RFC3339}).With().Caller().Logger()
 	} else {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: redactWriter{out: os.Stdout}, TimeFormat: time.RFC3339})
 	}
 }
 
@@ -39,7 +38,7 @@ func ConfigureTerraformProviderLogging(logLevel string, logCaller bool) {
 		l = zerolog.InfoLevel
 	}
 	zerolog.SetGlobalLevel(l)
-	output := zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339, NoColor: true, PartsExclude: []string{zerolog.TimestampFieldName}}
+	output := zerolog.ConsoleWriter{Out: redactWriter{out: os.Stderr}, TimeFormat: time.RFC3339, NoColor: true, PartsExclude: []string{zerolog.TimestampFieldName}}
 	output.FormatLevel = func(i interface{}) string {
 		return strings.ToUpper(fmt.Sprintf("[%s]", i))
 	}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces sensitive values in log output
+const Redacted = "(sensitive value)"
+
+// secrets holds every sensitive value seen by the provider, which must never show up in log output
+var secrets = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: make(map[string]bool)}
+
+// minSecretLength is the length below which values are not redacted, as replacing every occurrence of a value such as
+// "1" or "yes" would garble the log output while hiding next to nothing
+const minSecretLength = 4
+
+// RegisterSecrets marks values which must be redacted from all log output. Values are also redacted in the form
+// they take inside a JSON string, as structured log fields are written as JSON.
+func RegisterSecrets(values ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, v := range values {
+		if len(v) < minSecretLength {
+			continue
+		}
+		secrets.values[v] = true
+		if escaped, err := json.Marshal(v); err == nil {
+			secrets.values[string(escaped[1:len(escaped)-1])] = true
+		}
+	}
+}
+
+// registeredSecrets returns the registered secrets, longest first so a secret containing another one is fully redacted
+func registeredSecrets() []string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	values := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
+
+// Redact replaces every registered secret in s
+func Redact(s string) string {
+	for _, v := range registeredSecrets() {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	return s
+}
+
+// RedactVariables returns a copy of variables where the values of the sensitive variables are replaced, so the
+// variables can be logged
+func RedactVariables(variables map[string]interface{}, sensitive []string) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(variables))
+	for k, v := range variables {
+		redacted[k] = v
+	}
+	for _, k := range sensitive {
+		if _, ok := redacted[k]; ok {
+			redacted[k] = Redacted
+		}
+	}
+	return redacted
+}
+
+// MaskSecrets returns a context where tflog masks every registered secret in messages and fields
+func MaskSecrets(ctx context.Context) context.Context {
+	if values := registeredSecrets(); len(values) > 0 {
+		return tflog.MaskLogStrings(ctx, values...)
+	}
+	return ctx
+}
+
+// redactWriter redacts the registered secrets from the zerolog output
+type redactWriter struct {
+	out io.Writer
+}
+
+func (w redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	RegisterSecrets("s3cr3t", "s3cr3t-longer", "", "yes", `pa"ss\word`)
+
+	assert.Equal(t, "password=(sensitive value) token=(sensitive value)", Redact("password=s3cr3t token=s3cr3t-longer"))
+	assert.Equal(t, "nothing to hide", Redact("nothing to hide"))
+
+	// short values are not redacted, and values are redacted both as is and as escaped in a JSON string
+	assert.Equal(t, "become=yes", Redact("become=yes"))
+	assert.Equal(t, `raw (sensitive value) json {"pass":"(sensitive value)"}`, Redact(`raw pa"ss\word json {"pass":"pa\"ss\\word"}`))
+
+	variables := map[string]interface{}{"ansible_user": "root", "ansible_become_pass": "s3cr3t"}
+	redacted := RedactVariables(variables, []string{"ansible_become_pass", "unknown"})
+	assert.Equal(t, map[string]interface{}{"ansible_user": "root", "ansible_become_pass": Redacted}, redacted)
+	assert.Equal(t, "s3cr3t", variables["ansible_become_pass"])
+
+	var out bytes.Buffer
+	n, err := redactWriter{out: &out}.Write([]byte("become password is s3cr3t\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, len("become password is s3cr3t\n"), n)
+	assert.Equal(t, "become password is (sensitive value)\n", out.String())
+}
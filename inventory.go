@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/habakke/terraform-ansible-provider/internal/util"
+	"io"
+	"os"
+	"time"
+)
+
+// importLockTimeout is how long an import waits for a running terraform apply to release the inventory
+const importLockTimeout = 30 * time.Second
+
+// isInventoryCommand checks if the program was invoked as an Ansible dynamic inventory script rather than as a
+// terraform plugin, either through the inventory subcommand or directly with --list/--host as Ansible does
+func isInventoryCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "inventory", "--list", "-list", "--host", "-host":
+		return true
+	default:
+		return false
+	}
+}
+
+// runInventory prints dynamic inventory JSON for the database found at the inventory path, or imports an existing
+// INI inventory into the database
+func runInventory(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "inventory" {
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	fs.SetOutput(out)
+	list := fs.Bool("list", false, "List all groups and hosts in the inventory")
+	host := fs.String("host", "", "Show the variables of a single host")
+	importFile := fs.String("import", "", "Import the groups and hosts of an INI inventory file into the database")
+	path := fs.String("path", util.GetEnv("INVENTORY_PATH", "."), "Path to the ansible inventory (defaults to $INVENTORY_PATH)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	modes := 0
+	for _, set := range []bool{*list, *host != "", *importFile != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		return fmt.Errorf("exactly one of --list, --host <name> or --import <file> must be specified")
+	}
+	if *importFile != "" {
+		return importINI(*path, *importFile, out)
+	}
+
+	db, err := database.Open(*path, database.StorageJSON)
+	if err != nil {
+		return err
+	}
+	if !db.Exists() {
+		return fmt.Errorf("no inventory database found at '%s'", db.Path())
+	}
+	if err := db.Load(); err != nil {
+		return err
+	}
+
+	var data []byte
+	if *list {
+		data, err = ansible.RenderJSON(db)
+	} else {
+		data, err = ansible.RenderHostJSON(db, *host)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// importINI adds the groups and hosts of an existing INI inventory to the database at the inventory path, so they can
+// be adopted with terraform import
+func importINI(path string, file string, out io.Writer) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory '%s': %s", file, err.Error())
+	}
+
+	// a named inventory is locked at the provider path, like the provider does for every inventory under it
+	root := inventory.RootPath(path)
+	lock, err := inventory.Lock(root, importLockTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to lock inventory path '%s': %s", root, err.Error())
+	}
+	defer lock.Unlock()
+
+	db, err := database.Open(path, database.StorageJSON)
+	if err != nil {
+		return err
+	}
+	if db.Exists() {
+		if err := db.Load(); err != nil {
+			return err
+		}
+	}
+	allVars, err := inventory.DecodeINI(data, db)
+	if err != nil {
+		return fmt.Errorf("failed to import inventory '%s': %s", file, err.Error())
+	}
+	if err := db.Commit(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "imported %d groups into '%s'\n", len(*db.AllGroups()), db.Path())
+	if err == nil && len(allVars) > 0 {
+		_, err = fmt.Fprintln(out, "variables from [all:vars] are not imported, add them to the group_vars of the ansible_inventory resource")
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/database"
+	"github.com/habakke/terraform-ansible-provider/internal/ansible/inventory"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const InventoryPath = "/tmp/inventory_script"
+
+func TestInventoryCommand(t *testing.T) {
+	assert.True(t, isInventoryCommand([]string{"inventory", "--list"}))
+	assert.True(t, isInventoryCommand([]string{"--list"}))
+	assert.True(t, isInventoryCommand([]string{"--host", "192.168.0.180"}))
+	assert.False(t, isInventoryCommand([]string{}))
+	assert.False(t, isInventoryCommand([]string{"-debug"}))
+}
+
+func TestRunInventory(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(InventoryPath, os.ModePerm))
+	defer os.RemoveAll(InventoryPath)
+
+	db := database.NewDatabase(InventoryPath)
+	variables := make(map[string]interface{})
+	variables["role"] = "master"
+	master := database.NewGroup("master")
+	_ = master.AddEntity(database.NewHost("192.168.0.180", variables))
+	_ = db.AddGroup(*master)
+	assert.NoError(t, db.Commit())
+
+	var list bytes.Buffer
+	assert.NoError(t, runInventory([]string{"inventory", "--list", "--path", InventoryPath}, &list))
+	var inv map[string]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(list.Bytes(), &inv))
+	assert.Equal(t, []interface{}{"192.168.0.180"}, inv["master"]["hosts"])
+
+	var host bytes.Buffer
+	assert.NoError(t, runInventory([]string{"--host", "192.168.0.180", "--path", InventoryPath}, &host))
+	var vars map[string]interface{}
+	assert.NoError(t, json.Unmarshal(host.Bytes(), &vars))
+	assert.Equal(t, "master", vars["role"])
+
+	var unknown bytes.Buffer
+	assert.NoError(t, runInventory([]string{"--host", "unknown", "--path", InventoryPath}, &unknown))
+	assert.Equal(t, "{}\n", unknown.String())
+
+	assert.Error(t, runInventory([]string{"inventory", "--path", InventoryPath}, &bytes.Buffer{}))
+}
+
+func TestImportInventory(t *testing.T) {
+	assert.NoError(t, os.MkdirAll(InventoryPath, os.ModePerm))
+	defer os.RemoveAll(InventoryPath)
+
+	file := InventoryPath + "/hosts.ini"
+	assert.NoError(t, os.WriteFile(file, []byte("[master]\nmaster-1 role=server\n\n[all:vars]\na=1\n"), os.ModePerm))
+
+	var out bytes.Buffer
+	assert.NoError(t, runInventory([]string{"inventory", "--import", file, "--path", InventoryPath}, &out))
+	assert.Contains(t, out.String(), "[all:vars] are not imported")
+
+	db := database.NewDatabase(InventoryPath)
+	assert.NoError(t, db.Load())
+	h, err := db.FindHostByName("master-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "server", h.GetVariables()["role"])
+
+	assert.Error(t, runInventory([]string{"inventory", "--list", "--import", file, "--path", InventoryPath}, &bytes.Buffer{}))
+}
+
+func TestImportNamedInventory(t *testing.T) {
+	named := filepath.Join(InventoryPath, "staging")
+	assert.NoError(t, os.MkdirAll(named, os.ModePerm))
+	defer os.RemoveAll(InventoryPath)
+
+	file := InventoryPath + "/hosts.ini"
+	assert.NoError(t, os.WriteFile(file, []byte("[master]\nmaster-1\n"), os.ModePerm))
+
+	// the provider holds the lock of the provider path while it changes a named inventory
+	lock, err := inventory.Lock(InventoryPath, time.Second)
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		done <- runInventory([]string{"inventory", "--import", file, "--path", named}, &bytes.Buffer{})
+	}()
+	select {
+	case <-done:
+		assert.Fail(t, "the import did not wait for the lock of the provider path")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.NoError(t, lock.Unlock())
+	assert.NoError(t, <-done)
+
+	db := database.NewDatabase(named)
+	assert.NoError(t, db.Load())
+	_, err = db.FindHostByName("master-1")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(named, ".terraform-provider-ansible.lock"))
+}
@@ -23,6 +23,14 @@ func getVersionString(name string) string {
 }
 
 func main() {
+	if isInventoryCommand(os.Args[1:]) {
+		if err := runInventory(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx := context.Background()
 	logger := util.NewTerraformLogger()
 	path, err := os.Getwd()